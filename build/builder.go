@@ -1,6 +1,7 @@
 package build
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -8,11 +9,12 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	dockerclient2 "github.com/fsouza/go-dockerclient"
 	"github.com/l0rd/docker-unit/build/commands"
 	"github.com/l0rd/docker-unit/build/parser"
-	"github.com/l0rd/docker-unit/build/util"
 	"github.com/samalba/dockerclient"
 )
 
@@ -45,18 +47,45 @@ type handlerFunc func(args []string, heredoc string) error
 // Builder is able to build docker images from a local context directory, a
 // Dockerfile, and a docker client connection.
 type Builder struct {
-	daemonURL           string
-	tlsConfig           *tls.Config
-	client              *dockerclient.DockerClient
-	client2             *dockerclient2.Client
-	contextDirectory    string
-	dockerfilePath      string
-	dockerTestfilePath  string
-	dockerfileTests     *DockerfileTests
-	dockerfileTestStats *TestStats
-	repo, tag           string
-
-	out io.Writer
+	daemonURL          string
+	tlsConfig          *tls.Config
+	client             *dockerclient.DockerClient
+	client2            *dockerclient2.Client
+	contextDirectory   string
+	dockerfilePath     string
+	dockerTestfilePath string
+	dockerTestfile     []byte
+	dockerfileTests    *DockerfileTests
+	repo, tag          string
+	image              string
+	checkHistory       bool
+	updateSnapshots    bool
+	minCoverage        float64
+	debugOnFailure     bool
+	keepOnFailure      bool
+	noTestCache        bool
+
+	testResults      *TestResults
+	ephemeralResults map[*parser.Command]assertionRef
+	currentStep      *StepResult
+	currentAssertion *assertionRef
+	checkedSteps     map[*parser.Command]bool
+	checkedStep      *checkedStep
+	serviceNetwork   string
+	serviceImages    map[string]string
+	reporters        []Reporter
+	stepNum          int
+	runID            string
+	containers       map[string]struct{}
+	containerSeq     int
+	passedResults    map[string]*AssertionResult
+	testCacheChanged bool
+	debuggedFailure  error
+
+	out      io.Writer
+	debugOut io.Writer
+	logger   *log.Logger
+	verbose  bool
 
 	config              *config
 	maintainer          string
@@ -65,91 +94,103 @@ type Builder struct {
 	uncommitted         bool
 	uncommittedCommands []string
 
-	cache map[string]string
+	cache             map[string]string
+	stepCache         map[string]cachedStep
+	cacheFilePath     string
+	testCacheFilePath string
 
 	handlers map[string]handlerFunc
 }
 
-// NewBuilder creates a new builder.
-func NewBuilder(daemonURL string, tlsConfig *tls.Config, contextDirectory, dockerfilePath, repoTag string) (*Builder, error) {
+// NewBuilder creates a new builder for the given context directory,
+// configured with the given options.
+func NewBuilder(contextDirectory string, options ...Option) (*Builder, error) {
 	// Validate that the context directory exists.
 	stat, err := os.Stat(contextDirectory)
 	if err != nil {
-		return nil, fmt.Errorf("unable to access build context directory: %s", err)
+		return nil, configErrorf("unable to access build context directory: %s", err)
 	}
 	if !stat.IsDir() {
-		return nil, fmt.Errorf("context must be a directory")
+		return nil, configErrorf("context must be a directory")
 	}
 
-	if dockerfilePath == "" {
-		// Use Default path.
-		dockerfilePath = filepath.Join(contextDirectory, "Dockerfile")
+	b := &Builder{
+		contextDirectory: contextDirectory,
+		out:              os.Stdout,
+		debugOut:         os.Stdout,
+		logger:           log.StandardLogger(),
+		config: &config{
+			Labels:       map[string]string{},
+			ExposedPorts: map[string]struct{}{},
+			Volumes:      map[string]struct{}{},
+		},
 	}
 
-	if _, err := os.Stat(dockerfilePath); err != nil {
-		return nil, fmt.Errorf("unable to access build file: %s", err)
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
 	}
 
-	dockerTestfilePath := ""
-	if _, err := os.Stat(dockerfilePath + "_test"); err == nil {
-		dockerTestfilePath = dockerfilePath + "_test"
-		fmt.Printf("Found test file: %s!\n\n", dockerTestfilePath)
+	if b.dockerfilePath == "" {
+		// Use Default path.
+		b.dockerfilePath = filepath.Join(contextDirectory, "Dockerfile")
 	}
 
-	// Validate the repository and tag.
-	repo, tag := util.ParseRepositoryTag(repoTag)
-	if repo != "" {
-		if err := util.ValidateRepositoryName(repo); err != nil {
-			return nil, fmt.Errorf("invalid repository name: %s", err)
-		}
-		if tag != "" {
-			if err := util.ValidateTagName(tag); err != nil {
-				return nil, fmt.Errorf("invalid tag: %s", err)
-			}
+	// The Dockerfile is not needed to test an existing image.
+	if _, err := os.Stat(b.dockerfilePath); err != nil && b.image == "" {
+		return nil, configErrorf("unable to access build file: %s", err)
+	}
+
+	if b.dockerTestfilePath == "" {
+		if _, err := os.Stat(b.dockerfilePath + testfileSuffix); err == nil {
+			b.dockerTestfilePath = b.dockerfilePath + testfileSuffix
 		}
 	}
+	if b.dockerTestfilePath == "" && b.image != "" {
+		return nil, configErrorf("no test file found for image %s", b.image)
+	}
 
-	client, err := dockerclient.NewDockerClient(daemonURL, tlsConfig)
-	if err != nil {
-		return nil, fmt.Errorf("unable to initialize client: %s", err)
+	if b.minCoverage > 0 && b.image != "" {
+		return nil, configErrorf("instruction coverage cannot be checked without building the Dockerfile")
 	}
 
-	client2, err := dockerclient2.NewClientFromEnv()
-	if err != nil {
-		return nil, fmt.Errorf("unable to initialize client2: %s", err)
+	if b.dockerTestfilePath != "" {
+		fmt.Fprintf(b.out, "Found test file: %s!\n\n", b.dockerTestfilePath)
 	}
 
-	b := &Builder{
-		daemonURL:          daemonURL,
-		tlsConfig:          tlsConfig,
-		client:             client,
-		client2:            client2,
-		contextDirectory:   contextDirectory,
-		dockerfilePath:     dockerfilePath,
-		dockerTestfilePath: dockerTestfilePath,
-		repo:               repo,
-		tag:                tag,
-		out:                os.Stdout,
-		config: &config{
-			Labels:       map[string]string{},
-			ExposedPorts: map[string]struct{}{},
-			Volumes:      map[string]struct{}{},
-		},
+	if err := b.connect(); err != nil {
+		return nil, err
 	}
 
+	if b.runID, err = newRunID(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	if b.cacheFilePath == "" {
+		if b.cacheFilePath, err = defaultCacheFilePath(); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+
+	b.reporters = append([]Reporter{NewTextReporter(b.out)}, b.reporters...)
+
 	// Register Dockerfile Directive Handlers
 	b.handlers = map[string]handlerFunc{
+		commands.CheckFile:  b.handleCheckFile,
+		commands.CheckStep:  b.handleCheckStep,
 		commands.Cmd:        b.handleCmd,
 		commands.Copy:       b.handleCopy,
 		commands.Entrypoint: b.handleEntrypoint,
 		commands.Env:        b.handleEnv,
-		commands.Ephemeral:  b.handleRun,
+		commands.Ephemeral:  b.handleEphemeral,
 		commands.Expose:     b.handleExpose,
 		commands.Extract:    b.handleExtract,
 		commands.From:       b.handleFrom,
 		commands.Label:      b.handleLabel,
 		commands.Maintainer: b.handleMaintainer,
 		commands.Run:        b.handleRun,
+		commands.Snapshot:   b.handleSnapshot,
 		commands.User:       b.handleUser,
 		commands.Volume:     b.handleVolume,
 		commands.Workdir:    b.handleWorkdir,
@@ -160,56 +201,132 @@ func NewBuilder(daemonURL string, tlsConfig *tls.Config, contextDirectory, docke
 	}
 
 	if err := b.loadCache(); err != nil {
-		return nil, fmt.Errorf("unable to load build cache: %s", err)
+		return nil, configErrorf("unable to load build cache: %s", err)
+	}
+
+	if !b.noTestCache {
+		b.testCacheFilePath = b.cacheFilePath + testCacheSuffix
+		if err := b.loadTestCache(); err != nil {
+			return nil, configErrorf("unable to load test cache: %s", err)
+		}
 	}
 
 	return b, nil
 }
 
+// connect initializes the clients of the docker daemon.
+func (b *Builder) connect() (err error) {
+	if b.daemonURL == "" {
+		if b.daemonURL, err = defaultDaemonURL(); err != nil {
+			return configErrorf("unable to get docker daemon address: %s", err)
+		}
+	}
+
+	if b.client, err = dockerclient.NewDockerClient(b.daemonURL, b.tlsConfig); err != nil {
+		return configErrorf("unable to initialize client: %s", err)
+	}
+
+	if b.client2 == nil {
+		if b.client2, err = newClient2(b.daemonURL, b.tlsConfig); err != nil {
+			return configErrorf("unable to initialize client2: %s", err)
+		}
+	}
+
+	return nil
+}
+
 // Run executes the build process.
 func (b *Builder) Run() error {
+	_, err := b.Test()
+
+	return err
+}
+
+// Test executes the build process and returns the outcome of every build step
+// and assertion. The results are returned even if the build or a test fails.
+func (b *Builder) Test() (*TestResults, error) {
+	b.testResults = &TestResults{
+		DockerfilePath: b.dockerfilePath,
+		TestfilePath:   b.dockerTestfilePath,
+	}
+
+	start := time.Now()
+	err := b.run()
+
+	// The containers of a failed step or assertion are left behind.
+	if removeErr := b.removeContainers(); err == nil {
+		err = removeErr
+	}
+
+	// The assertions that passed are kept even if the build failed later.
+	if saveErr := b.saveTestCache(); saveErr != nil && err == nil {
+		err = configErrorf("unable to save test cache: %s", saveErr)
+	}
+
+	if err == nil {
+		err = b.checkCoverage()
+	}
+
+	b.testResults.Duration = time.Since(start)
+
+	// The reporters are only notified once the test file has been parsed.
+	if b.dockerfileTests != nil {
+		for _, reporter := range b.reporters {
+			reporter.Finish(b.testResults)
+		}
+	}
+
+	return b.testResults, err
+}
+
+func (b *Builder) run() error {
+	if b.image != "" {
+		return b.testImage()
+	}
 
 	// Parse the Dockerfile.
 	dockerfile, err := os.Open(b.dockerfilePath)
 	if err != nil {
-		return fmt.Errorf("unable to open Dockerfile: %s", err)
+		return configErrorf("unable to open Dockerfile: %s", err)
 	}
 	defer dockerfile.Close()
 
 	commands, err := parser.Parse(dockerfile)
 	if err != nil {
-		return fmt.Errorf("unable to parse Dockerfile: %s", err)
+		return configErrorf("unable to parse Dockerfile: %s", err)
 	}
 
 	if len(commands) == 0 {
-		return fmt.Errorf("no commands found in Dockerfile")
+		return configErrorf("no commands found in Dockerfile")
 	}
 
 	// Parse the DockerTestfile if it exists
 	if b.dockerTestfilePath != "" {
 
-		tester, err := newTester(b.dockerTestfilePath)
-
+		tester, err := b.parseTests()
 		if err != nil {
 			return err
 		}
 
-		b.dockerfileTests = tester
-
-		commands, err = Inject(commands, tester)
+		commands, b.testResults.Coverage, err = injectTests(commands, tester)
 
 		if err != nil {
-			return err
+			return &ConfigError{Err: err}
 		}
 
-		b.dockerfileTestStats = &TestStats{
-			TotalNumberOfTests: GetTotalNumberOfTests(tester),
-			NumberOfTestRan:    0,
-			NumberOfTestPassed: 0,
-			NumberOfTestFailed: 0,
+		b.checkedSteps = findCheckedSteps(commands)
+
+		// Map every injected EPHEMERAL to the result of the assertion it
+		// was generated from.
+		b.ephemeralResults = map[*parser.Command]assertionRef{}
+		for i := range tester.testBlocks {
+			for j := range tester.testBlocks[i].Ephemerals {
+				b.ephemeralResults[&tester.testBlocks[i].Ephemerals[j]] = assertionRef{
+					block:  b.testResults.Blocks[i],
+					result: b.testResults.Blocks[i].Assertions[j],
+				}
+			}
 		}
-
-		defer printStats(*b)
 	}
 
 	for i, command := range commands {
@@ -217,6 +334,7 @@ func (b *Builder) Run() error {
 			return err
 		}
 	}
+	b.checkedStep = nil
 
 	// create container and commit if we need to (because of trailing
 	// metadata directives).
@@ -224,18 +342,18 @@ func (b *Builder) Run() error {
 
 		b.containerID, err = b.createContainer([]string{"/bin/sh", "-c"}, []string{"#(nop)"}, false)
 		if err != nil {
-			return fmt.Errorf("unable to create container: %s", err)
+			return daemonErrorf("unable to create container: %s", err)
 		}
 
 		if err := b.commit(); err != nil {
-			return fmt.Errorf("unable to commit container image: %s", err)
+			return daemonErrorf("unable to commit container image: %s", err)
 		}
 	}
 
 	imageName := b.imageID
 	if b.repo != "" {
 		if err := b.setTag(imageName, b.repo, b.tag); err != nil {
-			return fmt.Errorf("unable to tag built image: %s", err)
+			return daemonErrorf("unable to tag built image: %s", err)
 		}
 
 		imageName = b.repo
@@ -244,13 +362,40 @@ func (b *Builder) Run() error {
 		}
 	}
 
+	b.testResults.ImageID = b.imageID
+	b.testResults.ImageName = imageName
+
 	fmt.Fprintf(b.out, "Successfully built %s\n", imageName)
 
 	if err := b.dispatchPostBuildTests(); err != nil {
 		return err
 	}
 
-	return nil
+	// The build went on after a failed assertion was debugged.
+	return b.debuggedFailure
+}
+
+// parseTests parses the test file and initializes the results of its
+// assertions.
+func (b *Builder) parseTests() (*DockerfileTests, error) {
+	var (
+		tester *DockerfileTests
+		err    error
+	)
+	if b.dockerTestfile != nil {
+		tester, err = parseTester(bytes.NewReader(b.dockerTestfile))
+	} else {
+		tester, err = newTester(b.dockerTestfilePath)
+	}
+
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	b.dockerfileTests = tester
+	b.testResults.Blocks = newBlockResults(tester)
+
+	return tester, nil
 }
 
 func (b *Builder) dispatch(stepNum int, command *parser.Command) error {
@@ -258,12 +403,12 @@ func (b *Builder) dispatch(stepNum int, command *parser.Command) error {
 
 	// FROM must be the first and only the first command.
 	if (stepNum == 0) != (cmd == commands.From) {
-		return fmt.Errorf("FROM must be the first Dockerfile command")
+		return configErrorf("FROM must be the first Dockerfile command")
 	}
 
 	handler, exists := b.handlers[cmd]
 	if !exists {
-		return fmt.Errorf("unknown command: %q", cmd)
+		return configErrorf("unknown command: %q", cmd)
 	}
 
 	if _, ok := commands.ReplaceEnvAllowed[cmd]; ok {
@@ -271,7 +416,7 @@ func (b *Builder) dispatch(stepNum int, command *parser.Command) error {
 		for i, arg := range args {
 			arg, err := processShellWord(arg, b.config.Env)
 			if err != nil {
-				return err
+				return configErrorf("unable to expand %s arguments: %s", cmd, err)
 			}
 
 			args[i] = arg
@@ -283,41 +428,101 @@ func (b *Builder) dispatch(stepNum int, command *parser.Command) error {
 
 	fmt.Fprintf(b.out, "Step %d: %s\n", stepNum, commandStr)
 
-	if cmd != commands.Ephemeral {
+	b.stepNum = stepNum
+	start := time.Now()
+
+	_, isAssertion := commands.TestCommands[cmd]
+
+	// The state to restore if the instruction fails as expected.
+	uncommitted, uncommittedCommands := b.uncommitted, len(b.uncommittedCommands)
+
+	if !isAssertion {
 		b.uncommitted = true
 		b.uncommittedCommands = append(b.uncommittedCommands, commandStr)
-	} else {
-		// must set uncommitted = false
-		// to make it clear that it's an
-		// EPHEMERAL command when handler()
-		// is called
-		b.uncommitted = false
-		b.dockerfileTestStats.NumberOfTestRan += 1
-	}
 
-	if err := handler(args, command.Heredoc); err != nil {
+		b.checkedStep = nil
+		if expectFailure, checked := b.checkedSteps[command]; checked {
+			b.checkedStep = &checkedStep{expectFailure: expectFailure}
+		}
+
+		b.currentStep = &StepResult{Step: stepNum, Command: commandStr}
+		b.testResults.Steps = append(b.testResults.Steps, b.currentStep)
+
+		b.emit(&Event{Type: EventStepStarted, Step: stepNum, Command: commandStr})
+	} else {
 		if cmd == commands.Ephemeral {
-			b.dockerfileTestStats.NumberOfTestFailed += 1
+			// must set uncommitted = false
+			// to make it clear that it's an
+			// EPHEMERAL command when handler()
+			// is called
+			b.uncommitted = false
+		}
+
+		// An EPHEMERAL written in the Dockerfile is not an assertion of the
+		// test file and has no result to record.
+		if assertion, ok := b.ephemeralResults[command]; ok {
+			b.startAssertion(assertion)
+
+			if b.reuseResult(assertion, b.assertionKey(cmd, args, assertion)) {
+				return nil
+			}
 		}
-		return err
 	}
 
-	if cmd == commands.Ephemeral {
-		b.dockerfileTestStats.NumberOfTestPassed += 1
+	err := handler(args, command.Heredoc)
+
+	failedAsExpected := false
+	if step := b.checkedStep; !isAssertion && step != nil {
+		step.err = err
+		if !step.cached {
+			step.duration = time.Since(start)
+		}
+
+		// An instruction failing as expected leaves the image as it was
+		// before the instruction and the build goes on.
+		if step.expectFailure && isStepFailure(err) {
+			fmt.Fprintf(b.out, " failed as expected: %s\n", err)
+			b.uncommitted, b.uncommittedCommands = uncommitted, b.uncommittedCommands[:uncommittedCommands]
+			failedAsExpected, err = true, nil
+		}
 	}
 
 	// We may not need to commit now but we should if the current command may
 	// have modified the filesystem. `b.uncommitted` will be set back to false
 	// if there was a cache hit.
-	if _, needCommit := commands.FilesystemModifierCommands[cmd]; needCommit && b.uncommitted {
-		if err := b.commit(); err != nil {
-			return fmt.Errorf("unable to commit container image: %s", err)
+	if _, needCommit := commands.FilesystemModifierCommands[cmd]; err == nil && needCommit && b.uncommitted && !failedAsExpected {
+		if commitErr := b.commit(); commitErr != nil {
+			err = daemonErrorf("unable to commit container image: %s", commitErr)
+		}
+	}
+
+	var ref *assertionRef
+	if assertion, ok := b.ephemeralResults[command]; isAssertion && ok {
+		b.finishAssertion(assertion, start, err)
+		b.rememberResult(b.assertionKey(cmd, args, assertion), assertion.result)
+		ref = &assertion
+	} else if !isAssertion {
+		b.finishStep(start, err)
+	}
+
+	if err != nil {
+		err = stepError(stepNum, commandStr, ref, err)
+		b.keepFailure(ref, b.containerID, b.imageID, err)
+		if ref == nil || !b.debugging(err) {
+			return err
+		}
+
+		// The container of the failed assertion is kept to be debugged.
+		containerID := b.containerID
+		b.containerID = ""
+		if err := b.debugFailure(ref, debugCommand(command, ref), b.imageID, containerID, err); err != nil {
+			return err
 		}
 	}
 
 	if b.containerID != "" {
-		if err := b.client.RemoveContainer(b.containerID, true, true); err != nil {
-			return fmt.Errorf("unable to remove container: %s", err)
+		if err := b.removeContainer(b.containerID); err != nil {
+			return daemonErrorf("unable to remove container: %s", err)
 		}
 		b.containerID = ""
 		fmt.Fprintf(b.out, " removed temporary container %s\n", b.containerID)
@@ -341,9 +546,40 @@ func makeCommandString(cmd string, args ...string) string {
 	return fmt.Sprintf("%s %s", cmd, strings.Join(quotedArgs, " "))
 }
 
-func printStats(b Builder) {
-	fmt.Printf(fmt.Sprintln() +
-		fmt.Sprintln("----") +
-		b.TestsStatsString() +
-		fmt.Sprintln("\n----"))
+// TestResults returns the outcome of the last build, or nil if the builder
+// has not run yet.
+func (b *Builder) TestResults() *TestResults {
+	return b.testResults
+}
+
+// finishStep records the outcome of the current build step that started at
+// start and failed if err is not nil.
+func (b *Builder) finishStep(start time.Time, err error) {
+	step := b.currentStep
+	b.currentStep = nil
+
+	step.ImageID = b.imageID
+	step.Duration = time.Since(start)
+	if err != nil {
+		step.Failure = err.Error()
+	}
+
+	b.emit(&Event{
+		Type:     EventStepFinished,
+		Step:     step.Step,
+		Command:  step.Command,
+		Duration: step.Duration,
+		Failure:  step.Failure,
+	})
+}
+
+// emit sends an event about the current image to every reporter.
+func (b *Builder) emit(event *Event) {
+	event.Time = time.Now()
+	event.Dockerfile = b.dockerfilePath
+	event.ImageID = b.imageID
+
+	for _, reporter := range b.reporters {
+		reporter.Event(event)
+	}
 }
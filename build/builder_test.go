@@ -0,0 +1,100 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestDispatchDockerfileEphemeral(t *testing.T) {
+	var ran []string
+	b := &Builder{
+		out:              &bytes.Buffer{},
+		logger:           log.New(),
+		config:           &config{},
+		testResults:      &TestResults{},
+		ephemeralResults: map[*parser.Command]assertionRef{},
+		passedResults:    map[string]*AssertionResult{},
+	}
+	b.handlers = map[string]handlerFunc{
+		commands.Ephemeral: func(args []string, heredoc string) error {
+			ran = append(ran, args[0])
+			if args[0] == "false" {
+				return errors.New("exit status 1")
+			}
+			return nil
+		},
+	}
+
+	if err := b.dispatch(1, &parser.Command{Args: []string{"EPHEMERAL", "true"}}); err != nil {
+		t.Fatalf("Unexpected error dispatching a Dockerfile EPHEMERAL: %s", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("Expected the Dockerfile EPHEMERAL to run, ran %v", ran)
+	}
+	if len(b.testResults.Steps) != 0 || len(b.passedResults) != 0 {
+		t.Errorf("Expected no result recorded for a Dockerfile EPHEMERAL")
+	}
+
+	err := b.dispatch(2, &parser.Command{Args: []string{"EPHEMERAL", "false"}})
+	var stepErr *BuildStepError
+	if !errors.As(err, &stepErr) {
+		t.Errorf("Expected a build step error for a failed Dockerfile EPHEMERAL, found %v", err)
+	}
+}
+
+type finishedReporter struct {
+	finished []*TestResults
+}
+
+func (r *finishedReporter) Event(event *Event) {}
+
+func (r *finishedReporter) Finish(results *TestResults) {
+	r.finished = append(r.finished, results)
+}
+
+func (r *finishedReporter) Close() error {
+	return nil
+}
+
+func TestTestFinishesReporters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builder")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfilePath := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfilePath, []byte("RUN true\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+
+	reporter := &finishedReporter{}
+	b := &Builder{
+		out:                &bytes.Buffer{},
+		logger:             log.New(),
+		dockerfilePath:     dockerfilePath,
+		dockerTestfilePath: "Testfile",
+		dockerTestfile:     []byte("@AFTER_RUN\nASSERT_TRUE FILE_EXISTS '/etc/passwd'\n"),
+		reporters:          []Reporter{reporter},
+	}
+
+	results, err := b.Test()
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected a configuration error for a Dockerfile not starting with FROM, found %v", err)
+	}
+	if len(reporter.finished) != 1 || reporter.finished[0] != results {
+		t.Fatalf("Expected the reporter to be finished once with the results, found %v", reporter.finished)
+	}
+	if results.Duration <= 0 {
+		t.Errorf("Expected the results to have a duration once the reporters are finished")
+	}
+}
@@ -5,26 +5,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/user"
-	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
 )
 
+// cacheFileMu serializes access to the cache file so that builders running
+// concurrently do not overwrite each other's entries.
+var cacheFileMu sync.Mutex
+
+// stepCacheSuffix is appended to the path of the build cache file to get the
+// path of the file where the outcome of the instructions checked by step
+// assertions is kept.
+const stepCacheSuffix = ".steps"
+
+// cachedStep is the outcome of an instruction checked by step assertions,
+// replayed when the image it committed is reused from the cache.
+type cachedStep struct {
+	Output   string
+	Duration time.Duration
+}
+
 func (b *Builder) probeCache() bool {
-	imageID, cacheHit := b.cache[b.getCacheKey()]
+	cacheKey := b.getCacheKey()
+
+	imageID, cacheHit := b.cache[cacheKey]
 	if !cacheHit {
 		return false
 	}
 
+	// Instructions checked by step assertions run again unless their
+	// outcome was kept with the image.
+	var outcome cachedStep
+	if b.checkedStep != nil {
+		if outcome, cacheHit = b.stepCache[cacheKey]; !cacheHit {
+			return false
+		}
+	}
+
 	if _, err := b.client.InspectImage(imageID); err != nil {
 		return false
 	}
 
+	if step := b.checkedStep; step != nil {
+		step.output.WriteString(outcome.Output)
+		step.duration = outcome.Duration
+		step.cached = true
+	}
+
 	b.imageID = imageID
 	b.uncommitted = false
 	b.uncommittedCommands = nil
 
 	fmt.Fprintf(b.out, " cache hit ---> %s\n", b.imageID)
 
+	if b.currentStep != nil {
+		b.currentStep.CacheHit = true
+	}
+
+	b.emit(&Event{Type: EventCacheHit, Step: b.stepNum})
+
 	return true
 }
 
@@ -42,20 +82,37 @@ func (b *Builder) getCacheKey() string {
 }
 
 func (b *Builder) setCache(imageID string) error {
-	b.cache[b.getCacheKey()] = imageID
+	cacheKey := b.getCacheKey()
+	b.cache[cacheKey] = imageID
+
+	if step := b.checkedStep; step != nil {
+		b.stepCache[cacheKey] = cachedStep{Output: step.output.String(), Duration: step.duration}
+
+		if err := saveCacheFile(b.cacheFilePath+stepCacheSuffix, &b.stepCache); err != nil {
+			return err
+		}
+	}
 
 	return b.saveCache()
 }
 
 func (b *Builder) loadCache() (err error) {
 	b.cache = map[string]string{}
+	b.stepCache = map[string]cachedStep{}
 
-	usr, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("unable to get current user: %s", err)
+	cacheFileMu.Lock()
+	defer cacheFileMu.Unlock()
+
+	if err := readCacheFile(b.cacheFilePath, &b.cache); err != nil {
+		return err
 	}
 
-	cacheFilename := fmt.Sprintf("%s%c%s", usr.HomeDir, filepath.Separator, ".dockerunitcache")
+	return readCacheFile(b.cacheFilePath+stepCacheSuffix, &b.stepCache)
+}
+
+// readCacheFile decodes a cache file into cache, a pointer to a map, adding
+// its entries to the existing ones.
+func readCacheFile(cacheFilename string, cache interface{}) (err error) {
 	cacheFile, err := os.Open(cacheFilename)
 	if os.IsNotExist(err) {
 		// No cache file exists to load.
@@ -70,20 +127,35 @@ func (b *Builder) loadCache() (err error) {
 		}
 	}()
 
-	if err := json.NewDecoder(cacheFile).Decode(&b.cache); err != nil {
-		return fmt.Errorf("unable to decode build cache: %s", err)
+	if err := json.NewDecoder(cacheFile).Decode(cache); err != nil {
+		return fmt.Errorf("unable to decode cache file: %s", err)
 	}
 
 	return nil
 }
 
-func (b *Builder) saveCache() (err error) {
-	usr, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("unable to get current user: %s", err)
+func (b *Builder) saveCache() error {
+	return saveCacheFile(b.cacheFilePath, &b.cache)
+}
+
+// saveCacheFile writes cache, a pointer to a map, to a cache file.
+func saveCacheFile(cacheFilename string, cache interface{}) (err error) {
+	cacheFileMu.Lock()
+	defer cacheFileMu.Unlock()
+
+	// Merge the entries written by other builders since this one loaded
+	// the cache, keeping its own entries as they are newer.
+	written := reflect.New(reflect.TypeOf(cache).Elem())
+	if err := readCacheFile(cacheFilename, written.Interface()); err != nil {
+		return err
+	}
+	entries := reflect.ValueOf(cache).Elem()
+	for _, key := range written.Elem().MapKeys() {
+		if !entries.MapIndex(key).IsValid() {
+			entries.SetMapIndex(key, written.Elem().MapIndex(key))
+		}
 	}
 
-	cacheFilename := fmt.Sprintf("%s%c%s", usr.HomeDir, filepath.Separator, ".dockerunitcache")
 	cacheFile, err := os.OpenFile(cacheFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(0600))
 	if err != nil {
 		return fmt.Errorf("unable to open cache file: %s", err)
@@ -94,8 +166,8 @@ func (b *Builder) saveCache() (err error) {
 		}
 	}()
 
-	if err := json.NewEncoder(cacheFile).Encode(b.cache); err != nil {
-		return fmt.Errorf("unable to encode build cache: %s", err)
+	if err := json.NewEncoder(cacheFile).Encode(cache); err != nil {
+		return fmt.Errorf("unable to encode cache file: %s", err)
 	}
 
 	return nil
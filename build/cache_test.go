@@ -0,0 +1,95 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestSaveCacheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("unable to create cache directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cacheFilename := filepath.Join(dir, ".dockerunitcache")
+	if err := saveCacheFile(cacheFilename, &map[string]string{"step": "sha256:stale", "other": "sha256:2"}); err != nil {
+		t.Fatalf("Unexpected error saving the cache file: %s", err)
+	}
+
+	cache := map[string]string{"step": "sha256:rebuilt"}
+	if err := saveCacheFile(cacheFilename, &cache); err != nil {
+		t.Fatalf("Unexpected error saving the cache file: %s", err)
+	}
+	if cache["step"] != "sha256:rebuilt" || cache["other"] != "sha256:2" {
+		t.Errorf("Expected the entries of the file to be merged without overwriting newer ones, found %v", cache)
+	}
+
+	saved := map[string]string{}
+	if err := readCacheFile(cacheFilename, &saved); err != nil {
+		t.Fatalf("Unexpected error reading the cache file: %s", err)
+	}
+	if saved["step"] != "sha256:rebuilt" || saved["other"] != "sha256:2" {
+		t.Errorf("Unexpected entries saved in the cache file: %v", saved)
+	}
+}
+
+func TestProbeCacheCheckedStep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("unable to create cache directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(dockerclient.ImageInfo{Id: "sha256:2"})
+	}))
+	defer server.Close()
+
+	client, err := dockerclient.NewDockerClient(server.URL, nil)
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+
+	newBuilder := func() *Builder {
+		b := &Builder{out: &bytes.Buffer{}, client: client, cacheFilePath: filepath.Join(dir, ".dockerunitcache"), imageID: "sha256:1", uncommittedCommands: []string{"RUN make"}}
+		if err := b.loadCache(); err != nil {
+			t.Fatalf("Unexpected error loading the cache: %s", err)
+		}
+		b.checkedStep = &checkedStep{}
+		return b
+	}
+
+	b := newBuilder()
+	if err := saveCacheFile(b.cacheFilePath, &map[string]string{b.getCacheKey(): "sha256:2"}); err != nil {
+		t.Fatalf("Unexpected error saving the cache file: %s", err)
+	}
+	b = newBuilder()
+	if b.probeCache() {
+		t.Errorf("Expected a checked step without a cached outcome to run again")
+	}
+
+	b.checkedStep.output.WriteString("WARNING: deprecated\n")
+	b.checkedStep.duration = 3 * time.Second
+	if err := b.setCache("sha256:2"); err != nil {
+		t.Fatalf("Unexpected error caching the image: %s", err)
+	}
+
+	b = newBuilder()
+	if !b.probeCache() {
+		t.Fatalf("Expected a cache hit for a checked step with a cached outcome")
+	}
+	step := b.checkedStep
+	if b.imageID != "sha256:2" || step.output.String() != "WARNING: deprecated\n" || step.duration != 3*time.Second || !step.cached {
+		t.Errorf("Unexpected replayed outcome: image %s, output %q, duration %s, cached %t", b.imageID, step.output.String(), step.duration, step.cached)
+	}
+}
@@ -0,0 +1,252 @@
+package build
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"syscall"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/samalba/dockerclient"
+)
+
+// runLabel is the label set to the run ID on the containers cunit creates,
+// except the ones of the build steps: their labels would be committed to the
+// images.
+const runLabel = "cunit.run"
+
+// Every container and service network cunit creates is named after the ID
+// of the run of its builder, to be found and removed by RemoveLeftovers if
+// the run could not remove it.
+var (
+	runContainerName = regexp.MustCompile(`^/?cunit-[0-9a-f]{12}-[0-9]+$`)
+	runNetworkName   = regexp.MustCompile(`^cunit-[0-9a-f]{12}$`)
+)
+
+// The builders with containers, to remove them if the process is interrupted.
+var (
+	liveMu       sync.Mutex
+	liveBuilders = map[*Builder]struct{}{}
+	interrupted  bool
+)
+
+// newRunID returns a random ID identifying the containers of a builder.
+func newRunID() (string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate run ID: %s", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// createTrackedContainer creates a container named after the run ID and
+// tracks it until it is removed with removeContainer. The container is
+// labeled with the run ID unless it is committed to an image.
+func (b *Builder) createTrackedContainer(config *dockerclient.ContainerConfig, committed bool) (string, error) {
+	if !committed {
+		labels := map[string]string{runLabel: b.runID}
+		for key, value := range config.Labels {
+			labels[key] = value
+		}
+		config.Labels = labels
+	}
+
+	liveMu.Lock()
+	b.containerSeq++
+	name := fmt.Sprintf("cunit-%s-%d", b.runID, b.containerSeq)
+	liveMu.Unlock()
+
+	containerID, err := b.client.CreateContainer(config, name)
+	if err != nil {
+		return "", err
+	}
+
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	// The containers created once the process is interrupted are removed
+	// right away, the others are removed by the signal handler.
+	if interrupted {
+		b.client.RemoveContainer(containerID, true, true)
+		return "", fmt.Errorf("interrupted")
+	}
+
+	if b.containers == nil {
+		b.containers = map[string]struct{}{}
+	}
+	b.containers[containerID] = struct{}{}
+	liveBuilders[b] = struct{}{}
+
+	return containerID, nil
+}
+
+// removeContainer removes a container along with its volumes and stops
+// tracking it.
+func (b *Builder) removeContainer(containerID string) error {
+	if err := b.client.RemoveContainer(containerID, true, true); err != nil {
+		return err
+	}
+
+	b.keepContainer(containerID)
+
+	return nil
+}
+
+// keepContainer stops tracking a container that is left for the user to
+// inspect.
+func (b *Builder) keepContainer(containerID string) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	delete(b.containers, containerID)
+	if len(b.containers) == 0 {
+		delete(liveBuilders, b)
+	}
+}
+
+// removeContainers removes the containers the builder created and did not
+// remove, such as the ones of the failed build steps.
+func (b *Builder) removeContainers() error {
+	liveMu.Lock()
+	var containerIDs []string
+	for containerID := range b.containers {
+		containerIDs = append(containerIDs, containerID)
+	}
+	liveMu.Unlock()
+
+	var removeErr error
+	for _, containerID := range containerIDs {
+		if err := b.removeContainer(containerID); err != nil && removeErr == nil {
+			removeErr = daemonErrorf("unable to remove container: %s", err)
+		}
+	}
+	b.containerID = ""
+
+	return removeErr
+}
+
+// CleanupOnInterrupt makes the process remove the containers and the
+// service networks of the running builders when it receives SIGINT or
+// SIGTERM, then exit with code 128 plus the signal number.
+func CleanupOnInterrupt(out io.Writer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+
+		liveMu.Lock()
+		interrupted = true
+		builders := make(map[*Builder][]string, len(liveBuilders))
+		for b := range liveBuilders {
+			for containerID := range b.containers {
+				builders[b] = append(builders[b], containerID)
+			}
+		}
+		liveMu.Unlock()
+
+		fmt.Fprintf(out, "\nInterrupted, removing the containers of the run\n")
+		for b, containerIDs := range builders {
+			for _, containerID := range containerIDs {
+				if err := b.client.RemoveContainer(containerID, true, true); err != nil {
+					fmt.Fprintf(out, "unable to remove container %s: %s\n", containerID, err)
+				}
+			}
+			if network := b.serviceNetwork; network != "" {
+				if err := b.client2.RemoveNetwork(network); err != nil {
+					fmt.Fprintf(out, "unable to remove service network %s: %s\n", network, err)
+				}
+			}
+		}
+
+		code := 130
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+}
+
+// RemoveLeftovers removes the containers and the service networks left
+// behind by the runs that could not remove them, such as crashed or killed
+// ones, and prints what it removed to out. The runs in progress must be over
+// first, since their containers are removed too.
+func RemoveLeftovers(out io.Writer, options ...Option) error {
+	b := &Builder{out: out}
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return &ConfigError{Err: err}
+		}
+	}
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	containers, err := b.client2.ListContainers(dockerclient2.ListContainersOptions{All: true})
+	if err != nil {
+		return daemonErrorf("unable to list containers: %s", err)
+	}
+
+	removed := 0
+	for _, container := range containers {
+		if !isRunContainer(container) {
+			continue
+		}
+		if err := b.client.RemoveContainer(container.ID, true, true); err != nil {
+			return daemonErrorf("unable to remove container %s: %s", container.ID, err)
+		}
+		fmt.Fprintf(out, "removed container %s %s\n", shortID(container.ID), container.Names)
+		removed++
+	}
+
+	networks, err := b.client2.ListNetworks()
+	if err != nil {
+		return daemonErrorf("unable to list networks: %s", err)
+	}
+
+	for _, network := range networks {
+		if !runNetworkName.MatchString(network.Name) {
+			continue
+		}
+		if err := b.client2.RemoveNetwork(network.ID); err != nil {
+			return daemonErrorf("unable to remove network %s: %s", network.Name, err)
+		}
+		fmt.Fprintf(out, "removed network %s\n", network.Name)
+		removed++
+	}
+
+	fmt.Fprintf(out, "%d leftovers removed\n", removed)
+
+	return nil
+}
+
+// isRunContainer returns whether a container was created by cunit. The
+// containers started from the images of the failed assertions kept with
+// --keep-on-failure have an empty run label and are not.
+func isRunContainer(container dockerclient2.APIContainers) bool {
+	if container.Labels[runLabel] != "" {
+		return true
+	}
+	for _, name := range container.Names {
+		if runContainerName.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shortID returns the 12 first characters of a container or image ID.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"fmt"
+	"testing"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+)
+
+func TestRunID(t *testing.T) {
+	runID, err := newRunID()
+	if err != nil {
+		t.Fatalf("unable to generate run ID: %s", err)
+	}
+
+	if name := fmt.Sprintf("/cunit-%s-%d", runID, 3); !runContainerName.MatchString(name) {
+		t.Errorf("Expected %s to be the name of a container of a run", name)
+	}
+	if name := "cunit-" + runID; !runNetworkName.MatchString(name) {
+		t.Errorf("Expected %s to be the name of a service network", name)
+	}
+}
+
+func TestIsRunContainer(t *testing.T) {
+	containers := []struct {
+		container dockerclient2.APIContainers
+		expected  bool
+	}{
+		{dockerclient2.APIContainers{Names: []string{"/cunit-0123456789ab-1"}}, true},
+		{dockerclient2.APIContainers{Labels: map[string]string{runLabel: "0123456789ab"}}, true},
+		{dockerclient2.APIContainers{Names: []string{"/cunit-web"}}, false},
+		{dockerclient2.APIContainers{Names: []string{"/inspect"}, Labels: map[string]string{runLabel: ""}}, false},
+		{dockerclient2.APIContainers{Names: []string{"/nginx"}, Labels: map[string]string{"maintainer": "cunit"}}, false},
+	}
+
+	for _, test := range containers {
+		if isRunContainer(test.container) != test.expected {
+			t.Errorf("Expected isRunContainer(%+v) to be %t", test.container, test.expected)
+		}
+	}
+}
+
+func TestKeepContainer(t *testing.T) {
+	b := &Builder{containers: map[string]struct{}{"a": {}, "b": {}}}
+	liveBuilders[b] = struct{}{}
+
+	b.keepContainer("a")
+	if _, ok := liveBuilders[b]; !ok {
+		t.Errorf("Expected the builder to be live while it has containers")
+	}
+
+	b.keepContainer("b")
+	if _, ok := liveBuilders[b]; ok {
+		t.Errorf("Expected the builder not to be live without containers")
+	}
+	if len(b.containers) != 0 {
+		t.Errorf("Expected no tracked container, found %d", len(b.containers))
+	}
+}
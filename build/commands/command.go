@@ -3,52 +3,64 @@ package commands
 
 // List of Dockerfile commands.
 const (
-	Add         = "ADD"
-	After       = "@AFTER"
-	AfterRun    = "@AFTER_RUN"
-	AssertTrue  = "ASSERT_TRUE"
-	AssertFalse = "ASSERT_FALSE"
-	Before      = "@BEFORE"
-	Cmd         = "CMD"
-	Copy        = "COPY"
-	Entrypoint  = "ENTRYPOINT"
-	Ephemeral   = "EPHEMERAL"
-	Env         = "ENV"
-	Expose      = "EXPOSE"
-	Extract     = "EXTRACT"
-	From        = "FROM"
-	Label       = "LABEL"
-	Maintainer  = "MAINTAINER"
-	Onbuild     = "ONBUILD"
-	Run         = "RUN"
-	User        = "USER"
-	Volume      = "VOLUME"
-	Workdir     = "WORKDIR"
+	Add           = "ADD"
+	After         = "@AFTER"
+	AfterRun      = "@AFTER_RUN"
+	AfterRunExit  = "@AFTER_RUN_EXIT"
+	AssertTrue    = "ASSERT_TRUE"
+	AssertFalse   = "ASSERT_FALSE"
+	Before        = "@BEFORE"
+	CheckFile     = "CHECK_FILE"
+	CheckStep     = "CHECK_STEP"
+	Cmd           = "CMD"
+	Copy          = "COPY"
+	Entrypoint    = "ENTRYPOINT"
+	Ephemeral     = "EPHEMERAL"
+	Env           = "ENV"
+	ExpectFailure = "@EXPECT_FAILURE"
+	Expose        = "EXPOSE"
+	Extract       = "EXTRACT"
+	From          = "FROM"
+	Label         = "LABEL"
+	Maintainer    = "MAINTAINER"
+	Onbuild       = "ONBUILD"
+	Run           = "RUN"
+	Service       = "@SERVICE"
+	Snapshot      = "SNAPSHOT"
+	User          = "USER"
+	Volume        = "VOLUME"
+	Workdir       = "WORKDIR"
 )
 
 // Commands is a set of all Dockerfile commands.
 var Commands = map[string]struct{}{
-	Add:         {},
-	After:       {},
-	AfterRun:    {},
-	AssertTrue:  {},
-	AssertFalse: {},
-	Before:      {},
-	Cmd:         {},
-	Copy:        {},
-	Entrypoint:  {},
-	Ephemeral:   {},
-	Env:         {},
-	Expose:      {},
-	Extract:     {},
-	From:        {},
-	Label:       {},
-	Maintainer:  {},
-	Onbuild:     {},
-	Run:         {},
-	User:        {},
-	Volume:      {},
-	Workdir:     {},
+	Add:           {},
+	After:         {},
+	AfterRun:      {},
+	AfterRunExit:  {},
+	AssertTrue:    {},
+	AssertFalse:   {},
+	Before:        {},
+	CheckFile:     {},
+	CheckStep:     {},
+	Cmd:           {},
+	Copy:          {},
+	Entrypoint:    {},
+	Ephemeral:     {},
+	Env:           {},
+	ExpectFailure: {},
+	Expose:        {},
+	Extract:       {},
+	From:          {},
+	Label:         {},
+	Maintainer:    {},
+	Onbuild:       {},
+	Run:           {},
+	Service:       {},
+	Snapshot:      {},
+	User:          {},
+	Volume:        {},
+	Workdir:       {},
 }
 
 // FilesystemModifierCommands is a subset of commands that typically modify the
@@ -74,10 +86,21 @@ var ReplaceEnvAllowed = map[string]struct{}{
 	Workdir: {},
 }
 
+// TestCommands is a subset of commands that are injected in the Dockerfile
+// to run the assertions of a test file.
+var TestCommands = map[string]struct{}{
+	CheckFile: {},
+	CheckStep: {},
+	Ephemeral: {},
+	Snapshot:  {},
+}
+
 // NewTestBlock is a subset of test files commands that are used
 // to the start a new test block
 var NewTestBlock = map[string]struct{}{
-	AfterRun: {},
-	After:    {},
-	Before:   {},
+	AfterRun:      {},
+	AfterRunExit:  {},
+	After:         {},
+	Before:        {},
+	ExpectFailure: {},
 }
@@ -7,8 +7,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-
-	log "github.com/Sirupsen/logrus"
 )
 
 type containerCommitResponse struct {
@@ -16,7 +14,7 @@ type containerCommitResponse struct {
 }
 
 func (b *Builder) commit() error {
-	log.Debugf("committing container: %s", b.containerID)
+	b.logger.Debugf("committing container: %s", b.containerID)
 
 	if b.containerID == "" {
 		return fmt.Errorf("no container to commit")
@@ -41,14 +39,14 @@ func (b *Builder) commit() error {
 	path := fmt.Sprintf("/commit?%s", query.Encode())
 	req, err := http.NewRequest("POST", b.client.URL.String()+path, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("unable to prepare request: %s", err)
+		return daemonErrorf("unable to prepare request: %s", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := b.client.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to make request: %s", err)
+		return daemonErrorf("unable to make request: %s", err)
 	}
 	defer resp.Body.Close()
 
@@ -57,16 +55,16 @@ func (b *Builder) commit() error {
 		buf := bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
 		io.Copy(buf, resp.Body) // It's okay if this fails.
 
-		return fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, buf.String())
+		return daemonErrorf("request failed with status code %d: %s", resp.StatusCode, buf.String())
 	}
 
 	var commitResponse containerCommitResponse
 	if err := json.NewDecoder(resp.Body).Decode(&commitResponse); err != nil {
-		return fmt.Errorf("unable to decode commit response: %s", err)
+		return daemonErrorf("unable to decode commit response: %s", err)
 	}
 
-	if err := b.client.RemoveContainer(b.containerID, true, true); err != nil {
-		return fmt.Errorf("unable to remove container: %s", err)
+	if err := b.removeContainer(b.containerID); err != nil {
+		return daemonErrorf("unable to remove container: %s", err)
 	}
 
 	if err := b.setCache(commitResponse.ID); err != nil {
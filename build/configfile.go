@@ -0,0 +1,463 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// List of the conditions about the content of a configuration file of the
+// image:
+//
+//	ASSERT_TRUE JSON_PATH_EQUALS /etc/app.json .server.port 8080
+//	ASSERT_TRUE YAML_PATH_EQUALS /etc/app.yaml .databases[0].host db
+//	ASSERT_TRUE CONFIG_PATH_EQUALS /etc/app.yml .log.level info
+//	ASSERT_TRUE INI_VALUE /etc/php.ini PHP memory_limit 256M
+//	ASSERT_TRUE PROPERTIES_VALUE /opt/app/app.properties server.port 8080
+const (
+	jsonPathEquals   = "JSON_PATH_EQUALS"
+	yamlPathEquals   = "YAML_PATH_EQUALS"
+	configPathEquals = "CONFIG_PATH_EQUALS"
+	iniValue         = "INI_VALUE"
+	propertiesValue  = "PROPERTIES_VALUE"
+)
+
+// List of the formats of configuration files.
+const (
+	formatJSON       = "json"
+	formatYAML       = "yaml"
+	formatINI        = "ini"
+	formatProperties = "properties"
+)
+
+// configFileConditions are the formats read by every condition, the generic
+// one finding the format from the file extension.
+var configFileConditions = map[string]string{
+	jsonPathEquals:   formatJSON,
+	yamlPathEquals:   formatYAML,
+	configPathEquals: "",
+	iniValue:         formatINI,
+	propertiesValue:  formatProperties,
+}
+
+// configFileExtensions are the formats of the configuration files with the
+// given extensions.
+var configFileExtensions = map[string]string{
+	".json":       formatJSON,
+	".yaml":       formatYAML,
+	".yml":        formatYAML,
+	".ini":        formatINI,
+	".cfg":        formatINI,
+	".properties": formatProperties,
+}
+
+// maxConfigFileSize bounds the size of the configuration files read from the
+// containers.
+const maxConfigFileSize = 10 << 20
+
+// isConfigFileAssertion returns whether an assertion is about the content of
+// a configuration file.
+func isConfigFileAssertion(command *parser.Command) bool {
+	if len(command.Args) < 2 {
+		return false
+	}
+
+	_, ok := configFileConditions[command.Args[1]]
+	return ok
+}
+
+// validateConfigFileAssertion checks the arguments of an assertion about the
+// content of a configuration file.
+func validateConfigFileAssertion(command *parser.Command) error {
+	if err := checkAssertPrefix(command); err != nil {
+		return err
+	}
+
+	condition := command.Args[1]
+	switch expected := configFileArgs(condition); {
+	case len(command.Args)-2 != expected:
+		return fmt.Errorf("Condition %s accept %d arguments (found %d)", condition, expected, len(command.Args)-2)
+	case !strings.HasPrefix(command.Args[2], "/"):
+		return fmt.Errorf("Condition %s requires an absolute file path (found %s)", condition, command.Args[2])
+	}
+
+	if _, err := configFileFormat(condition, command.Args[2]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configFileArgs returns the number of arguments of a condition about the
+// content of a configuration file.
+func configFileArgs(condition string) int {
+	if condition == iniValue {
+		return 4 // file, section, key and value.
+	}
+
+	return 3 // file, path or key and value.
+}
+
+// configFileFormat returns the format of the file read by a condition.
+func configFileFormat(condition, file string) (string, error) {
+	if format := configFileConditions[condition]; format != "" {
+		return format, nil
+	}
+
+	format, ok := configFileExtensions[strings.ToLower(path.Ext(file))]
+	if !ok {
+		return "", fmt.Errorf("Condition %s cannot tell the format of %s from its extension, use %s, %s, %s or %s instead", condition, file, jsonPathEquals, yamlPathEquals, iniValue, propertiesValue)
+	}
+
+	return format, nil
+}
+
+// checkConfigFile reads a configuration file from a container through the
+// archive API and checks an assertion about its content.
+func (b *Builder) checkConfigFile(containerID string, command *parser.Command, result *AssertionResult) error {
+	condition, file := command.Args[1], command.Args[2]
+
+	format, err := configFileFormat(condition, file)
+	if err != nil {
+		return configErrorf("%s", err)
+	}
+
+	content, err := b.readContainerFile(containerID, file, maxConfigFileSize)
+	if err != nil {
+		return err
+	}
+
+	var (
+		expr, expected string
+		actual         interface{}
+		found          bool
+	)
+	switch format {
+	case formatINI:
+		var section, key string
+		if condition == iniValue {
+			section, key, expected = command.Args[3], command.Args[4], command.Args[5]
+			expr = section + "." + key
+		} else {
+			expr, expected = command.Args[3], command.Args[4]
+			section, key = splitINIPath(expr)
+		}
+		values, err := parseINI(content)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %s", file, err)
+		}
+		actual, found = values[section][key]
+	case formatProperties:
+		expr, expected = strings.TrimPrefix(command.Args[3], "."), command.Args[4]
+		values, err := parseProperties(content)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %s", file, err)
+		}
+		actual, found = values[expr]
+	default:
+		expr, expected = command.Args[3], command.Args[4]
+		var document interface{}
+		if format == formatJSON {
+			document, err = parseJSON(content)
+		} else {
+			document, err = parseYAML(content)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %s", file, err)
+		}
+		if actual, found, err = lookupPath(document, expr); err != nil {
+			return configErrorf("invalid path %s: %s", expr, err)
+		}
+	}
+
+	if !found {
+		result.Stdout = fmt.Sprintf("%s: %s is not set\n", file, expr)
+		if command.Args[0] == commands.AssertFalse {
+			return nil
+		}
+		return fmt.Errorf("expected %s to be set in %s", expr, file)
+	}
+
+	value := formatConfigValue(actual)
+	result.Stdout = fmt.Sprintf("%s: %s = %s\n", file, expr, value)
+
+	return checkHolds(command.Args[0], value == expected,
+		fmt.Sprintf("%s in %s to equal %q (found %q)", expr, file, expected, value),
+		fmt.Sprintf("%s in %s not to equal %q", expr, file, expected))
+}
+
+// parseJSON parses a JSON document, keeping the numbers as they are written.
+func parseJSON(content string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// parseINI returns the values of an INI file by section. The values before
+// the first section are in the section named "".
+func parseINI(content string) (map[string]map[string]string, error) {
+	values := map[string]map[string]string{"": {}}
+	section := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == ';' || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header", line)
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			if values[section] == nil {
+				values[section] = map[string]string{}
+			}
+			continue
+		}
+
+		i := strings.IndexAny(text, "=:")
+		if i < 0 {
+			// A key without value, such as a flag of my.cnf.
+			values[section][text] = ""
+			continue
+		}
+
+		value := strings.TrimSpace(text[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if j := strings.Index(value, " ;"); j >= 0 {
+			value = strings.TrimSpace(value[:j])
+		}
+		values[section][strings.TrimSpace(text[:i])] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// splitINIPath splits the path of a value of an INI file into its section
+// and its key: .section.key, or .key for the values before the first section.
+func splitINIPath(expr string) (section, key string) {
+	expr = strings.TrimPrefix(expr, ".")
+	if i := strings.Index(expr, "."); i >= 0 {
+		return expr[:i], expr[i+1:]
+	}
+
+	return "", expr
+}
+
+// parseProperties returns the values of a Java properties file.
+func parseProperties(content string) (map[string]string, error) {
+	values := map[string]string{}
+
+	var logical string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		text := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical == "" && (text == "" || text[0] == '#' || text[0] == '!') {
+			continue
+		}
+
+		// A line ending with an odd number of backslashes continues on
+		// the next one.
+		trailing := len(text) - len(strings.TrimRight(text, `\`))
+		if trailing%2 == 1 {
+			logical += text[:len(text)-1]
+			continue
+		}
+		logical += text
+
+		key, value := splitProperty(logical)
+		values[key] = value
+		logical = ""
+	}
+	if logical != "" {
+		key, value := splitProperty(logical)
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// splitProperty splits a line of a properties file into its unescaped key
+// and value, separated by =, : or whitespace.
+func splitProperty(line string) (key, value string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	return unescapeProperty(line[:end]), unescapeProperty(rest)
+}
+
+// unescapeProperty replaces the escape sequences of a properties file.
+func unescapeProperty(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i == len(text)-1 {
+			out.WriteByte(text[i])
+			continue
+		}
+		i++
+		switch text[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+4 < len(text) {
+				if r, err := strconv.ParseUint(text[i+1:i+5], 16, 16); err == nil {
+					out.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			out.WriteByte('u')
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+
+	return out.String()
+}
+
+// lookupPath returns the value at a path such as .server.port or
+// .servers[0].host in a document made of maps, slices and scalars, and
+// whether it is set. The path . is the whole document.
+func lookupPath(document interface{}, expr string) (interface{}, bool, error) {
+	if !strings.HasPrefix(expr, ".") {
+		return nil, false, fmt.Errorf("a path starts with a dot")
+	}
+
+	value := document
+	rest := expr[1:]
+	for rest != "" {
+		// Read a key, up to the next dot or index.
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if key := rest[:end]; key != "" {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			if value, ok = object[key]; !ok {
+				return nil, false, nil
+			}
+		} else if rest[0] == '.' {
+			return nil, false, fmt.Errorf("empty key")
+		}
+		rest = rest[end:]
+
+		// Read the indexes following the key.
+		for strings.HasPrefix(rest, "[") {
+			close := strings.Index(rest, "]")
+			if close < 0 {
+				return nil, false, fmt.Errorf("unterminated index")
+			}
+			index, err := strconv.Atoi(rest[1:close])
+			if err != nil || index < 0 {
+				return nil, false, fmt.Errorf("invalid index %s", rest[1:close])
+			}
+			array, ok := value.([]interface{})
+			if !ok || index >= len(array) {
+				return nil, false, nil
+			}
+			value = array[index]
+			rest = rest[close+1:]
+		}
+
+		if rest != "" {
+			if rest[0] != '.' {
+				return nil, false, fmt.Errorf("unexpected %s", rest)
+			}
+			if rest = rest[1:]; rest == "" {
+				return nil, false, fmt.Errorf("empty key")
+			}
+		}
+	}
+
+	return value, true, nil
+}
+
+// formatConfigValue returns the text a value is compared with: scalars as
+// they are written and collections as compact JSON with sorted keys.
+func formatConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, key := range keys {
+			name, _ := json.Marshal(key)
+			entries[i] = string(name) + ":" + formatConfigElement(v[key])
+		}
+		return "{" + strings.Join(entries, ",") + "}"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatConfigElement(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+
+	return fmt.Sprint(value)
+}
+
+// formatConfigElement formats a value nested in a collection, quoting the
+// strings.
+func formatConfigElement(value interface{}) string {
+	if s, ok := value.(string); ok {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	}
+
+	return formatConfigValue(value)
+}
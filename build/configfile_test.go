@@ -0,0 +1,281 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFileAssertion(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER COPY\n" +
+		"ASSERT_TRUE JSON_PATH_EQUALS /etc/app.json .server.port 8080\n" +
+		"@AFTER_RUN\n" +
+		"ASSERT_FALSE INI_VALUE /etc/php.ini PHP memory_limit 128M\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+	if args := tests.testBlocks[0].Ephemerals[0].Args; strings.Join(args, " ") != "CHECK_FILE ASSERT_TRUE JSON_PATH_EQUALS /etc/app.json .server.port 8080" {
+		t.Errorf("Unexpected configuration file check: %q", args)
+	}
+	if args := tests.testBlocks[1].Ephemerals[0].Args; len(args) != 0 {
+		t.Errorf("Expected no ephemeral in an %s block, found %q", tests.testBlocks[1].Position, args)
+	}
+
+	invalid := []string{
+		"@AFTER COPY\nASSERT_TRUE JSON_PATH_EQUALS /etc/app.json .server.port\n",
+		"@AFTER COPY\nASSERT_TRUE INI_VALUE /etc/php.ini memory_limit 256M\n",
+		"@AFTER COPY\nASSERT_TRUE YAML_PATH_EQUALS etc/app.yaml .port 80\n",
+		"@AFTER COPY\nASSERT_TRUE CONFIG_PATH_EQUALS /etc/app.conf .port 80\n",
+		"@AFTER COPY\nASSERT JSON_PATH_EQUALS /etc/app.json .port 80\n",
+	}
+	for _, test := range invalid {
+		if _, err := parseTester(strings.NewReader(test)); err == nil {
+			t.Errorf("Expected an error parsing %q", test)
+		}
+	}
+}
+
+func TestConfigFileFormat(t *testing.T) {
+	tests := []struct {
+		condition, file, format string
+	}{
+		{jsonPathEquals, "/etc/app.conf", formatJSON},
+		{configPathEquals, "/etc/app.JSON", formatJSON},
+		{configPathEquals, "/etc/app.yml", formatYAML},
+		{configPathEquals, "/etc/php.ini", formatINI},
+		{configPathEquals, "/opt/app.properties", formatProperties},
+	}
+	for _, test := range tests {
+		format, err := configFileFormat(test.condition, test.file)
+		if err != nil || format != test.format {
+			t.Errorf("Expected format %s for %s %s, found %s (%v)", test.format, test.condition, test.file, format, err)
+		}
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	document, err := parseJSON(`{"server": {"port": 8080, "ratio": 1.50, "debug": false, "hosts": ["a", "b"]}, "servers": [{"host": "db"}], "empty": null}`)
+	if err != nil {
+		t.Fatalf("unable to parse JSON: %s", err)
+	}
+
+	tests := []struct {
+		expr  string
+		value string
+		found bool
+	}{
+		{".server.port", "8080", true},
+		{".server.ratio", "1.50", true},
+		{".server.debug", "false", true},
+		{".server.hosts", `["a","b"]`, true},
+		{".server.hosts[1]", "b", true},
+		{".servers[0].host", "db", true},
+		{".servers[0]", `{"host":"db"}`, true},
+		{".empty", "null", true},
+		{".server.missing", "", false},
+		{".servers[1].host", "", false},
+		{".server.port.number", "", false},
+	}
+	for _, test := range tests {
+		value, found, err := lookupPath(document, test.expr)
+		if err != nil {
+			t.Errorf("unable to look up %s: %s", test.expr, err)
+			continue
+		}
+		if found != test.found || (found && formatConfigValue(value) != test.value) {
+			t.Errorf("Expected %s to be %q (found: %t), got %q (found: %t)", test.expr, test.value, test.found, formatConfigValue(value), found)
+		}
+	}
+
+	for _, expr := range []string{"server.port", ".server..port", ".servers[x]", ".servers[0", ".server."} {
+		if _, _, err := lookupPath(document, expr); err == nil {
+			t.Errorf("Expected an error looking up %s", expr)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	document, err := parseYAML(`---
+# Application settings
+server:
+  port: 8080   # the HTTP port
+  name: "web # 1"
+  tags: [a, 'b c', {d: e}]
+databases:
+- host: db1
+  port: 5432
+-   host: db2
+    options:
+      - ssl
+      -
+        timeout: 5
+log: ~
+motd: |
+  hello
+  world
+summary: >-
+  folded
+  text
+key with spaces: 'it''s'
+`)
+	if err != nil {
+		t.Fatalf("unable to parse YAML: %s", err)
+	}
+
+	tests := map[string]string{
+		".server.port":                     "8080",
+		".server.name":                     "web # 1",
+		".server.tags":                     `["a","b c",{"d":"e"}]`,
+		".databases[0].host":               "db1",
+		".databases[0].port":               "5432",
+		".databases[1].host":               "db2",
+		".databases[1].options[0]":         "ssl",
+		".databases[1].options[1].timeout": "5",
+		".log":                             "null",
+		".motd":                            "hello\nworld\n",
+		".summary":                         "folded text",
+		".key with spaces":                 "it's",
+	}
+	for expr, expected := range tests {
+		value, found, err := lookupPath(document, expr)
+		if err != nil || !found {
+			t.Errorf("Expected %s to be set (error: %v)", expr, err)
+			continue
+		}
+		if formatConfigValue(value) != expected {
+			t.Errorf("Expected %s to be %q, found %q", expr, expected, formatConfigValue(value))
+		}
+	}
+
+	for _, invalid := range []string{"a: 1\n  b: 2\n", "a: [1, 2\n", "just text\n",
+		"a: &x 1\nb: *x\n", "b: *x\n", "a: !!str 1\n", "- &x a\n", "a: [*x]\n", "&x a: 1\n"} {
+		if _, err := parseYAML(invalid); err == nil {
+			t.Errorf("Expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestParseYAMLRejectsAmbiguousInput(t *testing.T) {
+	cases := map[string]string{
+		"tab indentation":                "a:\n\tb: 1\n",
+		"tab indented sequence":          "a:\n- b\n\t- c\n",
+		"duplicate key":                  "a: 1\na: 2\n",
+		"duplicate nested key":           "a:\n  b: 1\n  b: 2\n",
+		"duplicate flow key":             "a: {b: 1, b: 2}\n",
+		"mapping value in a scalar":      "a: b: c\n",
+		"mapping value in a sequence":    "- a: b: c\n",
+		"mapping value in a flow scalar": "a: [b: c]\n",
+		"scalar ending with a colon":     "a: b:\n",
+	}
+	for name, content := range cases {
+		if document, err := parseYAML(content); err == nil {
+			t.Errorf("Expected an error parsing YAML with a %s, found %v", name, document)
+		}
+	}
+
+	document, err := parseYAML("url: http://example.com:8080/a\nquoted: 'b: c'\nspaced:  \t# comment\n")
+	if err != nil {
+		t.Fatalf("unable to parse YAML: %s", err)
+	}
+	if value, _, _ := lookupPath(document, ".url"); value != "http://example.com:8080/a" {
+		t.Errorf("Unexpected URL %v", value)
+	}
+	if value, _, _ := lookupPath(document, ".quoted"); value != "b: c" {
+		t.Errorf("Unexpected quoted value %v", value)
+	}
+}
+
+func TestParseYAMLCompactSequences(t *testing.T) {
+	document, err := parseYAML("matrix:\n- - a\n  - b\n- - - c\n- d & e\n")
+	if err != nil {
+		t.Fatalf("unable to parse YAML: %s", err)
+	}
+
+	tests := map[string]string{
+		".matrix[0]":       `["a","b"]`,
+		".matrix[1][0][0]": "c",
+		".matrix[2]":       "d & e",
+	}
+	for expr, expected := range tests {
+		value, found, err := lookupPath(document, expr)
+		if err != nil || !found {
+			t.Errorf("Expected %s to be set (error: %v)", expr, err)
+			continue
+		}
+		if formatConfigValue(value) != expected {
+			t.Errorf("Expected %s to be %q, found %q", expr, expected, formatConfigValue(value))
+		}
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	values, err := parseINI(`; global settings
+engine = On
+
+[PHP]
+memory_limit = 256M ; per script
+error_log = "/var/log/php errors.log"
+
+[mysqld]
+skip-name-resolve
+port: 3306
+`)
+	if err != nil {
+		t.Fatalf("unable to parse INI: %s", err)
+	}
+
+	tests := []struct {
+		section, key, value string
+	}{
+		{"", "engine", "On"},
+		{"PHP", "memory_limit", "256M"},
+		{"PHP", "error_log", "/var/log/php errors.log"},
+		{"mysqld", "skip-name-resolve", ""},
+		{"mysqld", "port", "3306"},
+	}
+	for _, test := range tests {
+		value, ok := values[test.section][test.key]
+		if !ok || value != test.value {
+			t.Errorf("Expected [%s] %s to be %q, found %q (set: %t)", test.section, test.key, test.value, value, ok)
+		}
+	}
+
+	if section, key := splitINIPath(".PHP.memory_limit"); section != "PHP" || key != "memory_limit" {
+		t.Errorf("Expected section PHP and key memory_limit, found %s and %s", section, key)
+	}
+	if section, key := splitINIPath(".engine"); section != "" || key != "engine" {
+		t.Errorf("Expected no section and key engine, found %s and %s", section, key)
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	values, err := parseProperties(`# Spring settings
+! another comment
+server.port=8080
+spring.datasource.url : jdbc:postgresql://db/app
+greeting Hello \
+         World
+path\ with\ spaces = C:\\app
+unicode=caf\u00e9
+empty
+`)
+	if err != nil {
+		t.Fatalf("unable to parse properties: %s", err)
+	}
+
+	expected := map[string]string{
+		"server.port":           "8080",
+		"spring.datasource.url": "jdbc:postgresql://db/app",
+		"greeting":              "Hello World",
+		"path with spaces":      `C:\app`,
+		"unicode":               "café",
+		"empty":                 "",
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s to be %q, found %q", key, value, values[key])
+		}
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %d properties, found %d: %q", len(expected), len(values), values)
+	}
+}
@@ -0,0 +1,122 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// maxContainerFileLinks bounds the number of symbolic links followed to find
+// a file of a container.
+const maxContainerFileLinks = 10
+
+// isFileAssertion returns whether an assertion reads a file of the image
+// through the archive API rather than running a command in a container.
+func isFileAssertion(command *parser.Command) bool {
+	return isConfigFileAssertion(command) || isContextFileAssertion(command)
+}
+
+// validateFileAssertion checks the arguments of an assertion reading a file
+// of the image.
+func validateFileAssertion(command *parser.Command) error {
+	if isContextFileAssertion(command) {
+		return validateContextFileAssertion(command)
+	}
+
+	return validateConfigFileAssertion(command)
+}
+
+// fileCheck returns the command checking a file assertion against the image
+// at the point of the build where it is injected.
+func fileCheck(command *parser.Command) parser.Command {
+	return parser.Command{
+		Args: append([]string{commands.CheckFile}, command.Args...),
+		Line: command.Line,
+	}
+}
+
+// handleCheckFile checks an assertion about a file of the current image.
+func (b *Builder) handleCheckFile(args []string, heredoc string) error {
+	b.logger.Debugf("handling %s with args: %#v", commands.CheckFile, args)
+
+	if len(args) < 3 {
+		return fmt.Errorf("%s requires a file", commands.CheckFile)
+	}
+
+	result := &AssertionResult{}
+	if b.currentAssertion != nil {
+		result = b.currentAssertion.result
+	}
+
+	return b.withImageContainer(b.imageID, func(containerID string) error {
+		return b.checkFile(containerID, &parser.Command{Args: args}, result)
+	})
+}
+
+// checkFile checks an assertion about a file of a container.
+func (b *Builder) checkFile(containerID string, command *parser.Command, result *AssertionResult) error {
+	if isContextFileAssertion(command) {
+		return b.checkContextFile(containerID, command, result)
+	}
+
+	return b.checkConfigFile(containerID, command, result)
+}
+
+// readContainerFile returns the content of a regular file of a container,
+// following symbolic links, as long as it is not larger than limit bytes.
+func (b *Builder) readContainerFile(containerID, file string, limit int64) (string, error) {
+	for links := 0; links <= maxContainerFileLinks; links++ {
+		var (
+			content bytes.Buffer
+			link    string
+		)
+		err := b.readContainerArchiveFunc(func(w io.Writer) error {
+			return b.client2.DownloadFromContainer(containerID, dockerclient2.DownloadFromContainerOptions{Path: file, OutputStream: w})
+		}, func(archive *tar.Reader) error {
+			header, err := archive.Next()
+			if err != nil {
+				return err
+			}
+			switch header.Typeflag {
+			case tar.TypeReg:
+				if header.Size > limit {
+					return fmt.Errorf("%s is larger than %d bytes", file, limit)
+				}
+				_, err = io.Copy(&content, archive)
+				return err
+			case tar.TypeSymlink:
+				link = header.Linkname
+			default:
+				return fmt.Errorf("%s is not a regular file", file)
+			}
+			_, err = io.Copy(ioutil.Discard, archive)
+			return err
+		})
+		if err != nil {
+			if e, ok := err.(*DaemonError); ok {
+				if apiErr, ok := e.Err.(*dockerclient2.Error); ok && apiErr.Status == http.StatusNotFound {
+					return "", fmt.Errorf("file %s does not exist", file)
+				}
+			}
+			return "", err
+		}
+
+		if link == "" {
+			return content.String(), nil
+		}
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(file), link)
+		}
+		file = link
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic links")
+}
@@ -0,0 +1,184 @@
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// fileMatchesContext is the condition comparing a file of the image to a
+// file of the build context:
+//
+//	ASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf
+//	ASSERT_TRUE FILE_MATCHES_CONTEXT conf/app.ini /etc/app.ini IGNORE_WHITESPACE IGNORE_LINES '^#'
+const fileMatchesContext = "FILE_MATCHES_CONTEXT"
+
+// List of the options of FILE_MATCHES_CONTEXT.
+const (
+	ignoreWhitespace = "IGNORE_WHITESPACE"
+	ignoreLines      = "IGNORE_LINES"
+)
+
+// maxContextFileSize bounds the size of the files read from the containers
+// to be compared to the build context.
+const maxContextFileSize = 64 << 20
+
+// fileComparison is how FILE_MATCHES_CONTEXT compares two files: byte for
+// byte, or line by line once normalized.
+type fileComparison struct {
+	ignoreWhitespace bool
+	ignoreLines      []*regexp.Regexp
+}
+
+// isContextFileAssertion returns whether an assertion compares a file of the
+// image to a file of the build context.
+func isContextFileAssertion(command *parser.Command) bool {
+	return len(command.Args) > 1 && command.Args[1] == fileMatchesContext
+}
+
+// validateContextFileAssertion checks the arguments of a FILE_MATCHES_CONTEXT
+// <context-path> <container-path> [IGNORE_WHITESPACE] [IGNORE_LINES <regex>]
+// assertion.
+func validateContextFileAssertion(command *parser.Command) error {
+	if err := checkAssertPrefix(command); err != nil {
+		return err
+	}
+
+	if len(command.Args) < 4 {
+		return fmt.Errorf("Condition %s requires a build context path and a container path", fileMatchesContext)
+	}
+
+	if !insideContext(command.Args[2]) {
+		return fmt.Errorf("Condition %s requires a path inside the build context directory (found %s)", fileMatchesContext, command.Args[2])
+	}
+
+	if !strings.HasPrefix(command.Args[3], "/") {
+		return fmt.Errorf("Condition %s requires an absolute container path (found %s)", fileMatchesContext, command.Args[3])
+	}
+
+	_, err := parseFileComparison(command.Args[4:])
+	return err
+}
+
+// parseFileComparison parses the options of FILE_MATCHES_CONTEXT.
+func parseFileComparison(options []string) (*fileComparison, error) {
+	comparison := &fileComparison{}
+
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case ignoreWhitespace:
+			comparison.ignoreWhitespace = true
+		case ignoreLines:
+			if i+1 == len(options) {
+				return nil, fmt.Errorf("Condition %s option %s requires a regular expression", fileMatchesContext, ignoreLines)
+			}
+			i++
+			re, err := regexp.Compile(options[i])
+			if err != nil {
+				return nil, fmt.Errorf("Condition %s option %s has an invalid regular expression: %s", fileMatchesContext, ignoreLines, err)
+			}
+			comparison.ignoreLines = append(comparison.ignoreLines, re)
+		default:
+			return nil, fmt.Errorf("Condition %s accept %s and %s options (found %s)", fileMatchesContext, ignoreWhitespace, ignoreLines, options[i])
+		}
+	}
+
+	return comparison, nil
+}
+
+// exact returns whether the files are compared byte for byte.
+func (c *fileComparison) exact() bool {
+	return !c.ignoreWhitespace && len(c.ignoreLines) == 0
+}
+
+// lines returns the lines of a file that are compared, without the ignored
+// ones and with their whitespace collapsed if it is ignored.
+func (c *fileComparison) lines(content string) []string {
+	var lines []string
+
+next:
+	for _, line := range splitLines(strings.Replace(content, "\r\n", "\n", -1)) {
+		for _, re := range c.ignoreLines {
+			if re.MatchString(line) {
+				continue next
+			}
+		}
+		if c.ignoreWhitespace {
+			if line = strings.Join(strings.Fields(line), " "); line == "" {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// insideContext returns whether a path is relative to the build context
+// directory and does not leave it.
+func insideContext(p string) bool {
+	p = filepath.Clean(p)
+	return !filepath.IsAbs(p) && p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// checkContextFile compares a file of a container to a file of the build
+// context and prints a unified diff when they differ.
+func (b *Builder) checkContextFile(containerID string, command *parser.Command, result *AssertionResult) error {
+	contextPath, containerPath := command.Args[2], command.Args[3]
+
+	comparison, err := parseFileComparison(command.Args[4:])
+	if err != nil {
+		return configErrorf("%s", err)
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join(b.contextDirectory, contextPath))
+	if err != nil {
+		return configErrorf("unable to read %s from the build context: %s", contextPath, err)
+	}
+
+	actual, err := b.readContainerFile(containerID, containerPath, maxContextFileSize)
+	if err != nil {
+		return err
+	}
+
+	var matches bool
+	if comparison.exact() {
+		matches = string(expected) == actual
+		if !matches {
+			result.Stdout = describeFileDifference(contextPath, containerPath, string(expected), actual)
+		}
+	} else {
+		result.Stdout = unifiedDiff(contextPath, containerPath, comparison.lines(string(expected)), comparison.lines(actual))
+		matches = result.Stdout == ""
+	}
+
+	return checkHolds(command.Args[0], matches,
+		fmt.Sprintf("%s to match %s of the build context", containerPath, contextPath),
+		fmt.Sprintf("%s not to match %s of the build context", containerPath, contextPath))
+}
+
+// describeFileDifference returns a unified diff of two different text files,
+// or the sizes and the checksums of binary ones.
+func describeFileDifference(aName, bName, a, b string) string {
+	if isText(a) && isText(b) {
+		if diff := unifiedDiff(aName, bName, splitLines(a), splitLines(b)); diff != "" {
+			return diff
+		}
+		return "the files only differ by the newline at their end\n"
+	}
+
+	return fmt.Sprintf("binary files differ:\n%s: %d bytes, sha256:%x\n%s: %d bytes, sha256:%x\n",
+		aName, len(a), sha256.Sum256([]byte(a)), bName, len(b), sha256.Sum256([]byte(b)))
+}
+
+// isText returns whether the content of a file is text rather than binary.
+func isText(content string) bool {
+	return utf8.ValidString(content) && !bytes.Contains([]byte(content), []byte{0})
+}
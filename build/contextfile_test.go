@@ -0,0 +1,68 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseContextFileAssertion(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER COPY\n" +
+		"ASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf IGNORE_WHITESPACE IGNORE_LINES '^#'\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+	if args := tests.testBlocks[0].Ephemerals[0].Args; strings.Join(args, " ") != "CHECK_FILE ASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf IGNORE_WHITESPACE IGNORE_LINES ^#" {
+		t.Errorf("Unexpected file check: %q", args)
+	}
+
+	invalid := []string{
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT ../nginx.conf /etc/nginx/nginx.conf\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT /nginx.conf /etc/nginx/nginx.conf\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf etc/nginx/nginx.conf\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf IGNORE_LINES\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf IGNORE_LINES '('\n",
+		"@AFTER COPY\nASSERT_TRUE FILE_MATCHES_CONTEXT conf/nginx.conf /etc/nginx/nginx.conf IGNORE_CASE\n",
+	}
+	for _, test := range invalid {
+		if _, err := parseTester(strings.NewReader(test)); err == nil {
+			t.Errorf("Expected an error parsing %q", test)
+		}
+	}
+}
+
+func TestFileComparisonLines(t *testing.T) {
+	comparison, err := parseFileComparison([]string{"IGNORE_WHITESPACE", "IGNORE_LINES", "^#", "IGNORE_LINES", "generated at"})
+	if err != nil {
+		t.Fatalf("unable to parse options: %s", err)
+	}
+	if comparison.exact() {
+		t.Errorf("Expected a normalized comparison")
+	}
+
+	expected := comparison.lines("# nginx\nworker_processes  4;\n\nevents {\n\tworker_connections 1024;\n}\n")
+	actual := comparison.lines("# rendered\r\n# generated at 12:00\r\nworker_processes 4;\r\nevents {\r\n    worker_connections   1024;  \r\n}\r\n")
+	if diff := unifiedDiff("expected", "actual", expected, actual); diff != "" {
+		t.Errorf("Expected no differences, found:\n%s", diff)
+	}
+
+	exact, err := parseFileComparison(nil)
+	if err != nil || !exact.exact() {
+		t.Errorf("Expected an exact comparison without options (error: %v)", err)
+	}
+}
+
+func TestDescribeFileDifference(t *testing.T) {
+	diff := describeFileDifference("conf/app.conf", "/etc/app.conf", "a\nb\n", "a\nc\n")
+	if !strings.Contains(diff, "-b\n+c\n") {
+		t.Errorf("Expected a unified diff, found:\n%s", diff)
+	}
+
+	if diff := describeFileDifference("a", "b", "x\n", "x"); !strings.Contains(diff, "newline") {
+		t.Errorf("Expected a difference of final newline, found:\n%s", diff)
+	}
+
+	if diff := describeFileDifference("bin/app", "/usr/bin/app", "\x00\x01", "\x00\x02"); !strings.HasPrefix(diff, "binary files differ") {
+		t.Errorf("Expected a binary difference, found:\n%s", diff)
+	}
+}
@@ -13,14 +13,13 @@ import (
 	"strings"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/jlhawn/tarsum"
 	"github.com/l0rd/docker-unit/archive"
 	"github.com/l0rd/docker-unit/build/commands"
 )
 
 func (b *Builder) handleCopy(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Copy, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Copy, args)
 
 	if len(args) != 2 {
 		return fmt.Errorf("%s requires exactly two arguments", commands.Copy)
@@ -32,11 +31,11 @@ func (b *Builder) handleCopy(args []string, heredoc string) error {
 
 	containerID, err := b.createContainer([]string{"/bin/sh", "-c"}, []string{"#(nop)"}, false)
 	if err != nil {
-		return fmt.Errorf("unable to create container: %s", err)
+		return daemonErrorf("unable to create container: %s", err)
 	}
 
 	if err := b.copyToContainer(args[0], containerID, args[1]); err != nil {
-		return fmt.Errorf("unable to copy to container: %s", err)
+		return fmt.Errorf("unable to copy to container: %w", err)
 	}
 
 	b.containerID = containerID
@@ -48,19 +47,19 @@ func (b *Builder) checkCopyCache(srcPath string) bool {
 	srcPath = fmt.Sprintf("%s%c%s", b.contextDirectory, filepath.Separator, srcPath)
 	srcArchive, err := archive.TarResource(srcPath)
 	if err != nil {
-		log.Debugf("unable to archive source: %s", err)
+		b.logger.Debugf("unable to archive source: %s", err)
 		return false
 	}
 	defer srcArchive.Close()
 
 	digester, err := tarsum.NewDigest(tarsum.Version1)
 	if err != nil {
-		log.Debugf("unable to get new tarsum digester: %s", err)
+		b.logger.Debugf("unable to get new tarsum digester: %s", err)
 		return false
 	}
 
 	if _, err := io.Copy(digester, srcArchive); err != nil {
-		log.Debugf("unable to digest source archive: %s", err)
+		b.logger.Debugf("unable to digest source archive: %s", err)
 		return false
 	}
 
@@ -87,12 +86,12 @@ func (b *Builder) statContainerPath(container, path string) (*containerPathStat,
 	urlPath := fmt.Sprintf("/containers/%s/archive?%s", container, query.Encode())
 	req, err := http.NewRequest("HEAD", b.client.URL.String()+urlPath, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to prepare request: %s", err)
+		return nil, daemonErrorf("unable to prepare request: %s", err)
 	}
 
 	resp, err := b.client.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("unable to make request: %s", err)
+		return nil, daemonErrorf("unable to make request: %s", err)
 	}
 	defer resp.Body.Close()
 
@@ -105,7 +104,7 @@ func (b *Builder) statContainerPath(container, path string) (*containerPathStat,
 
 	var stat containerPathStat
 	if err = json.NewDecoder(statDecoder).Decode(&stat); err != nil {
-		return nil, fmt.Errorf("unable to decode container path stat header: %s", err)
+		return nil, daemonErrorf("unable to decode container path stat header: %s", err)
 	}
 
 	return &stat, nil
@@ -172,14 +171,14 @@ func (b *Builder) copyToContainer(srcPath, dstContainer, dstPath string) (err er
 	urlPath := fmt.Sprintf("/containers/%s/archive?%s", dstContainer, query.Encode())
 	req, err := http.NewRequest("PUT", b.client.URL.String()+urlPath, preparedArchive)
 	if err != nil {
-		return fmt.Errorf("unable to prepare request: %s", err)
+		return daemonErrorf("unable to prepare request: %s", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-tar")
 
 	resp, err := b.client.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to make request: %s", err)
+		return daemonErrorf("unable to make request: %s", err)
 	}
 	defer resp.Body.Close()
 
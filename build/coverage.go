@@ -0,0 +1,272 @@
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// InstructionCoverage lists the @BEFORE, @AFTER and @EXPECT_FAILURE blocks
+// exercising a Dockerfile instruction.
+type InstructionCoverage struct {
+	Line        int
+	Instruction string
+	Blocks      []string
+}
+
+// Covered returns whether at least one test block exercises the instruction.
+func (c *InstructionCoverage) Covered() bool {
+	return len(c.Blocks) > 0
+}
+
+// Coverage is the coverage of the instructions of a Dockerfile by the test
+// blocks of its test file.
+type Coverage struct {
+	Instructions []*InstructionCoverage
+}
+
+// Covered returns the number of instructions exercised by a test block.
+func (c *Coverage) Covered() int {
+	covered := 0
+	for _, instruction := range c.Instructions {
+		if instruction.Covered() {
+			covered++
+		}
+	}
+
+	return covered
+}
+
+// Percent returns the percentage of instructions exercised by a test block.
+func (c *Coverage) Percent() float64 {
+	if len(c.Instructions) == 0 {
+		return 100
+	}
+
+	return 100 * float64(c.Covered()) / float64(len(c.Instructions))
+}
+
+// String returns the coverage as "3/4 instructions (75.0%)".
+func (c *Coverage) String() string {
+	return fmt.Sprintf("%d/%d instructions (%.1f%%)", c.Covered(), len(c.Instructions), c.Percent())
+}
+
+// coversInstructions returns whether a test block exercises the Dockerfile
+// instruction it refers to, rather than the built image.
+func coversInstructions(testBlock *TestBlock) bool {
+	switch testBlock.Position {
+	case commands.Before, commands.After, commands.ExpectFailure:
+		return true
+	}
+
+	return false
+}
+
+// checkCoverage fails if the instruction coverage is below the minimum.
+func (b *Builder) checkCoverage() error {
+	if b.minCoverage <= 0 {
+		return nil
+	}
+
+	percent := 0.0
+	if b.testResults.Coverage != nil {
+		percent = b.testResults.Coverage.Percent()
+	}
+
+	if percent < b.minCoverage {
+		return fmt.Errorf("instruction coverage %.1f%% is below the minimum of %.1f%%", percent, b.minCoverage)
+	}
+
+	return nil
+}
+
+// coverageReporter prints the covered and uncovered instructions of every
+// Dockerfile.
+type coverageReporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewCoverageReporter returns a reporter printing the coverage of the
+// instructions of every Dockerfile by its test blocks to out.
+func NewCoverageReporter(out io.Writer) Reporter {
+	return &coverageReporter{out: out}
+}
+
+func (r *coverageReporter) Event(event *Event) {}
+
+func (r *coverageReporter) Finish(results *TestResults) {
+	if results.Coverage == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.out, "Coverage of %s: %s\n", results.DockerfilePath, results.Coverage)
+	for _, instruction := range results.Coverage.Instructions {
+		if instruction.Covered() {
+			fmt.Fprintf(r.out, "  covered   %4d %s (%s)\n", instruction.Line, instruction.Instruction, strings.Join(instruction.Blocks, ", "))
+		} else {
+			fmt.Fprintf(r.out, "  uncovered %4d %s\n", instruction.Line, instruction.Instruction)
+		}
+	}
+}
+
+func (r *coverageReporter) Close() error {
+	return nil
+}
+
+// jsonCoverage is the encoding of the coverage of a Dockerfile.
+type jsonCoverage struct {
+	Dockerfile   string                    `json:"dockerfile"`
+	Covered      int                       `json:"covered"`
+	Total        int                       `json:"total"`
+	Percent      float64                   `json:"percent"`
+	Instructions []jsonInstructionCoverage `json:"instructions"`
+}
+
+type jsonInstructionCoverage struct {
+	Line        int      `json:"line"`
+	Instruction string   `json:"instruction"`
+	Covered     bool     `json:"covered"`
+	Blocks      []string `json:"blocks"`
+}
+
+// coverageJSONReporter writes the coverage of every Dockerfile as a single
+// JSON document once they are all built.
+type coverageJSONReporter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	coverages []jsonCoverage
+}
+
+// NewCoverageJSONReporter returns a reporter writing the coverage of the
+// instructions of every Dockerfile by its test blocks as JSON to out.
+func NewCoverageJSONReporter(out io.Writer) Reporter {
+	return &coverageJSONReporter{out: out}
+}
+
+func (r *coverageJSONReporter) Event(event *Event) {}
+
+func (r *coverageJSONReporter) Finish(results *TestResults) {
+	if results.Coverage == nil {
+		return
+	}
+
+	encoded := jsonCoverage{
+		Dockerfile:   results.DockerfilePath,
+		Covered:      results.Coverage.Covered(),
+		Total:        len(results.Coverage.Instructions),
+		Percent:      results.Coverage.Percent(),
+		Instructions: []jsonInstructionCoverage{},
+	}
+	for _, instruction := range results.Coverage.Instructions {
+		blocks := instruction.Blocks
+		if blocks == nil {
+			blocks = []string{}
+		}
+		encoded.Instructions = append(encoded.Instructions, jsonInstructionCoverage{
+			Line:        instruction.Line,
+			Instruction: instruction.Instruction,
+			Covered:     instruction.Covered(),
+			Blocks:      blocks,
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.coverages = append(r.coverages, encoded)
+}
+
+func (r *coverageJSONReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	coverages := r.coverages
+	if coverages == nil {
+		coverages = []jsonCoverage{}
+	}
+
+	encoder := json.NewEncoder(r.out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		Dockerfiles []jsonCoverage `json:"dockerfiles"`
+	}{coverages})
+}
+
+// coverageDockerfileReporter writes every Dockerfile with the coverage of
+// its instructions in the margin.
+type coverageDockerfileReporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewCoverageDockerfileReporter returns a reporter writing every Dockerfile
+// to out, each instruction prefixed by the number of test blocks exercising
+// it, or by ##### if there is none.
+func NewCoverageDockerfileReporter(out io.Writer) Reporter {
+	return &coverageDockerfileReporter{out: out}
+}
+
+func (r *coverageDockerfileReporter) Event(event *Event) {}
+
+func (r *coverageDockerfileReporter) Finish(results *TestResults) {
+	if results.Coverage == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintf(r.out, "       # Coverage of %s: %s\n", results.DockerfilePath, results.Coverage)
+
+	dockerfile, err := os.Open(results.DockerfilePath)
+	if err != nil {
+		fmt.Fprintf(r.out, "       # unable to open Dockerfile: %s\n", err)
+		return
+	}
+	defer dockerfile.Close()
+
+	annotateDockerfile(r.out, dockerfile, results.Coverage)
+}
+
+func (r *coverageDockerfileReporter) Close() error {
+	return nil
+}
+
+// annotateDockerfile writes the lines of a Dockerfile to out, each prefixed
+// by the number of test blocks exercising the instruction starting on it,
+// ##### for an uncovered instruction and - for the other lines.
+func annotateDockerfile(out io.Writer, dockerfile io.Reader, coverage *Coverage) {
+	instructions := map[int]*InstructionCoverage{}
+	for _, instruction := range coverage.Instructions {
+		instructions[instruction.Line] = instruction
+	}
+
+	scanner := bufio.NewScanner(dockerfile)
+	for line := 1; scanner.Scan(); line++ {
+		margin := "-"
+		if instruction, ok := instructions[line]; ok {
+			margin = "#####"
+			if instruction.Covered() {
+				margin = fmt.Sprint(len(instruction.Blocks))
+			}
+		}
+		fmt.Fprintf(out, "%5s: %s\n", margin, scanner.Text())
+	}
+}
+
+// instructionString returns a Dockerfile instruction on a single line.
+func instructionString(command *parser.Command) string {
+	return strings.Join(command.Args, " ")
+}
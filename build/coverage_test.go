@@ -0,0 +1,131 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+const coverageDockerfile = `FROM ubuntu:14.04
+
+RUN apt-get update && \
+    apt-get install -y nginx
+COPY nginx.conf /etc/nginx/nginx.conf
+CMD ["nginx"]
+`
+
+func testCoverage(t *testing.T) *Coverage {
+	cmds, err := parser.Parse(strings.NewReader(coverageDockerfile))
+	if err != nil {
+		t.Fatalf("unable to parse Dockerfile: %s", err)
+	}
+	tests, err := parseTester(strings.NewReader("@AFTER RUN_APT-GET\n" +
+		"ASSERT_TRUE IS_INSTALLED 'nginx'\n" +
+		"@BEFORE COPY\n" +
+		"ASSERT_FALSE FILE_EXISTS '/etc/nginx/nginx.conf'\n" +
+		"@AFTER COPY\n" +
+		"ASSERT_TRUE FILE_EXISTS '/etc/nginx/nginx.conf'\n" +
+		"@AFTER_RUN\n" +
+		"ASSERT_TRUE PROCESS_EXISTS 'nginx'\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	_, coverage, err := injectTests(cmds, tests)
+	if err != nil {
+		t.Fatalf("unable to inject tests: %s", err)
+	}
+
+	return coverage
+}
+
+func TestInjectTestsCoverage(t *testing.T) {
+	coverage := testCoverage(t)
+
+	expected := []struct {
+		line   int
+		blocks int
+	}{
+		{1, 0},
+		{3, 1},
+		{5, 2},
+		{6, 0},
+	}
+	if len(coverage.Instructions) != len(expected) {
+		t.Fatalf("Expected %d instructions, found %d", len(expected), len(coverage.Instructions))
+	}
+	for i, instruction := range coverage.Instructions {
+		if instruction.Line != expected[i].line || len(instruction.Blocks) != expected[i].blocks {
+			t.Errorf("Expected line %d covered by %d blocks, found line %d covered by %q", expected[i].line, expected[i].blocks, instruction.Line, instruction.Blocks)
+		}
+	}
+
+	if coverage.Covered() != 2 || coverage.Percent() != 50 {
+		t.Errorf("Expected 2 covered instructions (50%%), found %s", coverage)
+	}
+}
+
+func TestAnnotateDockerfile(t *testing.T) {
+	var out bytes.Buffer
+	annotateDockerfile(&out, strings.NewReader(coverageDockerfile), testCoverage(t))
+
+	expected := "#####: FROM ubuntu:14.04\n" +
+		"    -: \n" +
+		"    1: RUN apt-get update && \\\n" +
+		"    -:     apt-get install -y nginx\n" +
+		"    2: COPY nginx.conf /etc/nginx/nginx.conf\n" +
+		"#####: CMD [\"nginx\"]\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected annotated Dockerfile:\n%s", out.String())
+	}
+}
+
+func TestCoverageJSONReporter(t *testing.T) {
+	var out bytes.Buffer
+	reporter := NewCoverageJSONReporter(&out)
+	reporter.Finish(&TestResults{DockerfilePath: "Dockerfile", Coverage: testCoverage(t)})
+	reporter.Finish(&TestResults{DockerfilePath: "image/Dockerfile"})
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("unable to write report: %s", err)
+	}
+
+	var report struct {
+		Dockerfiles []jsonCoverage `json:"dockerfiles"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("unable to decode report: %s", err)
+	}
+	if len(report.Dockerfiles) != 1 {
+		t.Fatalf("Expected the coverage of 1 Dockerfile, found %d", len(report.Dockerfiles))
+	}
+	if coverage := report.Dockerfiles[0]; coverage.Covered != 2 || coverage.Total != 4 || coverage.Percent != 50 || !coverage.Instructions[2].Covered {
+		t.Errorf("Unexpected coverage: %+v", coverage)
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	b := &Builder{testResults: &TestResults{Coverage: testCoverage(t)}}
+
+	if err := b.checkCoverage(); err != nil {
+		t.Errorf("Expected no error without minimum coverage, found %s", err)
+	}
+
+	b.minCoverage = 50
+	if err := b.checkCoverage(); err != nil {
+		t.Errorf("Expected no error with 50%% coverage, found %s", err)
+	}
+
+	b.minCoverage = 80
+	if err := b.checkCoverage(); err == nil {
+		t.Errorf("Expected an error with a minimum coverage of 80%%")
+	}
+
+	b.testResults.Coverage = nil
+	b.minCoverage = 10
+	if err := b.checkCoverage(); err == nil {
+		t.Errorf("Expected an error without coverage")
+	}
+}
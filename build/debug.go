@@ -0,0 +1,254 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// debugShell is the command of the containers opened to debug a failed
+// assertion: bash if the image has it, sh otherwise.
+var debugShell = []string{"/bin/sh", "-c", "command -v bash >/dev/null 2>&1 && exec bash || exec sh"}
+
+// debugFailure opens an interactive shell in a container from the image an
+// assertion failed against, once the failure err is printed along with the
+// command of the assertion and the container it ran in, which is kept. The
+// build goes on if the shell exits with code 0: nil is returned and err is
+// kept to fail the build once it is over. Otherwise err is returned and the
+// build is aborted.
+func (b *Builder) debugFailure(ref *assertionRef, command, imageID, containerID string, err error) error {
+	if ref == nil || !b.debugging(err) {
+		return err
+	}
+
+	out := b.debugOut
+	fmt.Fprintf(out, "\n--- DEBUG: %s line %d: %s\n", ref.block.Name(), ref.result.Line, ref.result.Assertion)
+	fmt.Fprintf(out, "     failure: %s\n", ref.result.Failure)
+	fmt.Fprintf(out, "     command: %s\n", command)
+	fmt.Fprintf(out, "     image: %s\n", imageID)
+	if containerID != "" {
+		b.keepContainer(containerID)
+		fmt.Fprintf(out, "     container: %s (kept, remove it with docker rm -f %s)\n", containerID, containerID)
+	}
+	fmt.Fprintf(out, "Opening a shell in a container from the image: exit to continue the build, exit 1 to abort it\n")
+
+	exitCode, shellErr := b.runDebugShell(imageID)
+	if shellErr != nil {
+		fmt.Fprintf(out, "unable to open debug shell: %s\n", shellErr)
+		return err
+	}
+
+	if exitCode != 0 {
+		fmt.Fprintf(out, "Aborting the build (shell exited with code %d)\n", exitCode)
+		return err
+	}
+
+	fmt.Fprintf(out, "Continuing the build\n")
+	if b.debuggedFailure == nil {
+		b.debuggedFailure = err
+	}
+
+	return nil
+}
+
+// debugging returns whether a debug shell is opened for the failure err:
+// only a failed assertion is debugged, not a daemon or configuration error.
+func (b *Builder) debugging(err error) bool {
+	var assertionErr *AssertionFailedError
+	return b.debugOnFailure && errors.As(err, &assertionErr)
+}
+
+// debugCommand returns the command run by an assertion: the command of its
+// EPHEMERAL, or the assertion itself if cunit checks it.
+func debugCommand(ephemeral *parser.Command, ref *assertionRef) string {
+	if len(ephemeral.Args) > 1 && ephemeral.Args[0] == commands.Ephemeral {
+		return makeCommandString(ephemeral.Args[1], ephemeral.Args[2:]...)
+	}
+
+	return ref.result.Assertion
+}
+
+// runDebugShell runs an interactive shell in a new container from the given
+// image, attached to the terminal, and returns its exit code once the shell
+// exits. The container is then removed.
+func (b *Builder) runDebugShell(imageID string) (exitCode int, err error) {
+	config := b.config.toDocker()
+	config.Entrypoint = debugShell[:1]
+	config.Cmd = debugShell[1:]
+	config.Image = imageID
+	config.Tty = true
+	config.OpenStdin = true
+	config.StdinOnce = true
+	config.AttachStdin = true
+	config.AttachStdout = true
+	config.AttachStderr = true
+
+	containerID, err := b.createTrackedContainer(config, false)
+	if err != nil {
+		return 0, daemonErrorf("unable to create container: %s", err)
+	}
+	defer func() {
+		if removeErr := b.removeContainer(containerID); removeErr != nil && err == nil {
+			err = daemonErrorf("unable to remove container: %s", removeErr)
+		}
+	}()
+
+	query := make(url.Values, 4)
+	query.Set("stream", "true")
+	query.Set("stdin", "true")
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	urlPath := fmt.Sprintf("/containers/%s/attach?%s", containerID, query.Encode())
+
+	// The input stops being forwarded to the container once the shell exits,
+	// without waiting for the next key stroke.
+	done := make(chan struct{})
+	in := &terminalInput{done: done}
+
+	hijackStarted := make(chan int, 1)
+	hijackErr := make(chan error, 1)
+	go func() {
+		hijackErr <- b.hijack("POST", urlPath, in, b.debugOut, hijackStarted)
+	}()
+
+	select {
+	case <-hijackStarted:
+	case err := <-hijackErr:
+		close(done)
+		return 0, daemonErrorf("unable to hijack attach tcp stream: %s", err)
+	}
+
+	restore := makeTerminalRaw()
+	defer restore()
+
+	if err := b.client.StartContainer(containerID, nil); err != nil {
+		close(done)
+		return 0, daemonErrorf("unable to start container: %s", err)
+	}
+
+	if height, width, ok := terminalSize(); ok {
+		b.client2.ResizeContainerTTY(containerID, height, width)
+	}
+
+	exitCode, err = b.client2.WaitContainer(containerID)
+	close(done)
+	if err != nil {
+		return 0, daemonErrorf("unable to wait for container: %s", err)
+	}
+
+	if err := <-hijackErr; err != nil {
+		return 0, daemonErrorf("unable to end hijack stream: %s", err)
+	}
+
+	return exitCode, nil
+}
+
+// terminalChunks receives what is read from the standard input. It is read
+// by a single goroutine for the whole process, since a read of the standard
+// input cannot be interrupted once a shell exits.
+var (
+	terminalOnce   sync.Once
+	terminalChunks chan []byte
+)
+
+// terminalInput reads the standard input until done is closed.
+type terminalInput struct {
+	done    <-chan struct{}
+	pending []byte
+}
+
+func (r *terminalInput) Read(p []byte) (int, error) {
+	terminalOnce.Do(func() {
+		terminalChunks = make(chan []byte)
+		go func() {
+			defer close(terminalChunks)
+			for {
+				buf := make([]byte, 1024)
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					terminalChunks <- buf[:n]
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+
+	if len(r.pending) == 0 {
+		select {
+		case chunk, ok := <-terminalChunks:
+			if !ok {
+				return 0, io.EOF
+			}
+			r.pending = chunk
+		case <-r.done:
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// makeTerminalRaw puts the terminal of the standard input in raw mode, for
+// the keys to be handled by the shell of the container, and returns the
+// function restoring it. Nothing is done if the standard input is not a
+// terminal.
+func makeTerminalRaw() func() {
+	state, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return func() {}
+	}
+
+	return func() {
+		stty(strings.TrimSpace(state))
+	}
+}
+
+// terminalSize returns the number of rows and columns of the terminal of the
+// standard input.
+func terminalSize() (height, width int, ok bool) {
+	size, err := stty("size")
+	if err != nil {
+		return 0, 0, false
+	}
+
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	height, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	width, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return height, width, true
+}
+
+// stty runs the stty command on the terminal of the standard input.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	return string(out), err
+}
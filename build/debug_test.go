@@ -0,0 +1,46 @@
+package build
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestDebugCommand(t *testing.T) {
+	ref := &assertionRef{block: &BlockResult{Position: "@AFTER_RUN"}, result: &AssertionResult{Assertion: "ASSERT_TRUE PROCESS_STOPS_ON SIGTERM 10s"}}
+
+	ephemeral := &parser.Command{Args: []string{"EPHEMERAL", "bash", "-c", "getent passwd www-data"}}
+	if command := debugCommand(ephemeral, ref); command != `bash -c "getent passwd www-data"` {
+		t.Errorf("Unexpected command of an EPHEMERAL: %s", command)
+	}
+
+	if command := debugCommand(&parser.Command{Line: 3}, ref); command != ref.result.Assertion {
+		t.Errorf("Expected the assertion as command of a placeholder, found %s", command)
+	}
+}
+
+func TestDebugFailure(t *testing.T) {
+	ref := &assertionRef{block: &BlockResult{Position: "@AFTER_RUN"}, result: &AssertionResult{Assertion: "ASSERT_TRUE USER_EXISTS www-data"}}
+	assertionErr := &AssertionFailedError{Err: errors.New("non-zero exit code: 2")}
+	daemonErr := daemonErrorf("unable to create container: no such image")
+
+	b := &Builder{}
+	if b.debugging(assertionErr) {
+		t.Errorf("Expected no debugging without --debug-on-failure")
+	}
+	if err := b.debugFailure(ref, "", "sha256:1", "", assertionErr); err != assertionErr {
+		t.Errorf("Expected the failure to be returned without debugging, found %v", err)
+	}
+
+	b.debugOnFailure = true
+	if !b.debugging(assertionErr) {
+		t.Errorf("Expected a failed assertion to be debugged")
+	}
+	if b.debugging(daemonErr) {
+		t.Errorf("Expected a daemon error not to be debugged")
+	}
+	if err := b.debugFailure(ref, "", "sha256:1", "", daemonErr); err != daemonErr {
+		t.Errorf("Expected the daemon error to be returned, found %v", err)
+	}
+}
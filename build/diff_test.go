@@ -0,0 +1,65 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := splitLines("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n")
+	b := splitLines("a\nb\nC\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n")
+
+	expected := "--- golden\n+++ actual\n" +
+		"@@ -1,6 +1,6 @@\n a\n b\n-c\n+C\n d\n e\n f\n" +
+		"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n"
+	if diff := unifiedDiff("golden", "actual", a, b); diff != expected {
+		t.Errorf("Expected diff:\n%s\nfound:\n%s", expected, diff)
+	}
+
+	if diff := unifiedDiff("golden", "actual", a, a); diff != "" {
+		t.Errorf("Expected no diff between identical lines, found:\n%s", diff)
+	}
+
+	if diff := unifiedDiff("golden", "actual", nil, []string{"x"}); diff != "--- golden\n+++ actual\n@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("Unexpected diff from nothing:\n%s", diff)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"a b c", ""},
+		{"", "a b c"},
+		{"a b c a b b a", "c b a b a c"},
+		{"x a y b z", "a b c"},
+	}
+
+	for _, c := range cases {
+		a, b := strings.Fields(c[0]), strings.Fields(c[1])
+
+		// Applying the edit script to a must give b.
+		var fromA, toB []string
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				fromA = append(fromA, op.line)
+			}
+			if op.kind != '-' {
+				toB = append(toB, op.line)
+			}
+		}
+		if strings.Join(fromA, " ") != c[0] || strings.Join(toB, " ") != c[1] {
+			t.Errorf("Invalid edit script from %q to %q: %q, %q", c[0], c[1], fromA, toB)
+		}
+	}
+
+	// The shortest edit script of the classic example has 5 edits.
+	edits := 0
+	for _, op := range diffLines(strings.Fields("a b c a b b a"), strings.Fields("c b a b a c")) {
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	if edits != 5 {
+		t.Errorf("Expected 5 edits, found %d", edits)
+	}
+}
@@ -0,0 +1,94 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// testfileSuffix is appended to the path of a Dockerfile to get the path of
+// its test file.
+const testfileSuffix = "_test"
+
+// Target is a Dockerfile found in a directory tree along with the test file
+// and the build context that go with it. RepoTag is the optional repository
+// name and tag given to the built image.
+type Target struct {
+	ContextDirectory string
+	DockerfilePath   string
+	TestfilePath     string
+	RepoTag          string
+}
+
+// Discover walks the directory tree rooted at root and returns a target for
+// every Dockerfile that has an associated test file. Hidden directories are
+// not walked. Targets are sorted by Dockerfile path.
+func Discover(root string) ([]Target, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access directory: %s", err)
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var targets []Target
+
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !isDockerfileName(info.Name()) {
+			return nil
+		}
+
+		testfilePath := path + testfileSuffix
+		if testStat, err := os.Stat(testfilePath); err != nil || testStat.IsDir() {
+			return nil
+		}
+
+		targets = append(targets, Target{
+			ContextDirectory: filepath.Dir(path),
+			DockerfilePath:   path,
+			TestfilePath:     testfilePath,
+		})
+
+		return nil
+	}
+
+	if err := filepath.Walk(root, walkFn); err != nil {
+		return nil, fmt.Errorf("unable to walk directory tree: %s", err)
+	}
+
+	sort.Sort(byDockerfilePath(targets))
+
+	return targets, nil
+}
+
+// isDockerfileName returns whether name is a conventional Dockerfile name:
+// "Dockerfile", "Dockerfile.<variant>" or "<variant>.Dockerfile".
+func isDockerfileName(name string) bool {
+	if strings.HasSuffix(name, testfileSuffix) {
+		return false
+	}
+
+	return name == "Dockerfile" ||
+		strings.HasPrefix(name, "Dockerfile.") ||
+		strings.HasSuffix(name, ".Dockerfile")
+}
+
+type byDockerfilePath []Target
+
+func (t byDockerfilePath) Len() int           { return len(t) }
+func (t byDockerfilePath) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byDockerfilePath) Less(i, j int) bool { return t[i].DockerfilePath < t[j].DockerfilePath }
@@ -0,0 +1,67 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-unit-discover")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	files := []string{
+		"Dockerfile",
+		"Dockerfile_test",
+		"web/Dockerfile",
+		"web/Dockerfile_test",
+		"web/Dockerfile.dev",
+		"db/postgres.Dockerfile",
+		"db/postgres.Dockerfile_test",
+		"untested/Dockerfile",
+		".git/Dockerfile",
+		".git/Dockerfile_test",
+	}
+
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unable to create dir: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("FROM scratch\n"), 0644); err != nil {
+			t.Fatalf("unable to create file: %s", err)
+		}
+	}
+
+	targets, err := Discover(root)
+	if err != nil {
+		t.Fatalf("unable to discover Dockerfiles: %s", err)
+	}
+
+	expected := []string{
+		"Dockerfile",
+		"db/postgres.Dockerfile",
+		"web/Dockerfile",
+	}
+
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, found %d: %v", len(expected), len(targets), targets)
+	}
+
+	for i, target := range targets {
+		dockerfilePath := filepath.Join(root, expected[i])
+		if target.DockerfilePath != dockerfilePath {
+			t.Errorf("Expected target[%d] Dockerfile %s, found %s", i, dockerfilePath, target.DockerfilePath)
+		}
+		if target.TestfilePath != dockerfilePath+"_test" {
+			t.Errorf("Expected target[%d] test file %s, found %s", i, dockerfilePath+"_test", target.TestfilePath)
+		}
+		if target.ContextDirectory != filepath.Dir(dockerfilePath) {
+			t.Errorf("Expected target[%d] context %s, found %s", i, filepath.Dir(dockerfilePath), target.ContextDirectory)
+		}
+	}
+}
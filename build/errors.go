@@ -0,0 +1,142 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConfigError is returned when the builder is misconfigured or when the
+// Dockerfile or the test file cannot be read or are invalid.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// DaemonError is returned when a request to the docker daemon fails. Step is
+// the number of the build step sending the request, or -1 if the request was
+// not sent by a build step.
+type DaemonError struct {
+	Step    int
+	Command string
+	Err     error
+}
+
+func (e *DaemonError) Error() string {
+	if e.Step < 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("step %d (%s): %s", e.Step, e.Command, e.Err)
+}
+
+func (e *DaemonError) Unwrap() error {
+	return e.Err
+}
+
+// BuildStepError is returned when an instruction of the Dockerfile fails, for
+// instance when the command of a RUN instruction exits with a non-zero code.
+type BuildStepError struct {
+	Step    int
+	Command string
+	Err     error
+}
+
+func (e *BuildStepError) Error() string {
+	return fmt.Sprintf("step %d (%s) failed: %s", e.Step, e.Command, e.Err)
+}
+
+func (e *BuildStepError) Unwrap() error {
+	return e.Err
+}
+
+// AssertionFailedError is returned when an assertion of the test file fails.
+// Step is the number of the build step running the assertion, or -1 for the
+// assertions run once the image is built.
+type AssertionFailedError struct {
+	Step      int
+	Command   string
+	Block     string
+	Assertion string
+	Line      int
+	Err       error
+}
+
+func (e *AssertionFailedError) Error() string {
+	return fmt.Sprintf("%s: %s failed: %s", e.Block, e.Assertion, e.Err)
+}
+
+func (e *AssertionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// daemonErrorf returns a DaemonError for a request to the docker daemon that
+// failed.
+func daemonErrorf(format string, args ...interface{}) error {
+	return &DaemonError{Step: -1, Err: fmt.Errorf(format, args...)}
+}
+
+// configErrorf returns a ConfigError.
+func configErrorf(format string, args ...interface{}) error {
+	return &ConfigError{Err: fmt.Errorf(format, args...)}
+}
+
+// stepError returns the typed error of the build step or of the assertion
+// (when ref is not nil) that failed with err.
+func stepError(stepNum int, command string, ref *assertionRef, err error) error {
+	var daemonErr *DaemonError
+	if errors.As(err, &daemonErr) {
+		if daemonErr.Step < 0 {
+			daemonErr.Step, daemonErr.Command = stepNum, command
+		}
+		return err
+	}
+
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return err
+	}
+
+	if ref != nil {
+		return &AssertionFailedError{
+			Step:      stepNum,
+			Command:   command,
+			Block:     ref.block.Name(),
+			Assertion: ref.result.Assertion,
+			Line:      ref.result.Line,
+			Err:       err,
+		}
+	}
+
+	return &BuildStepError{Step: stepNum, Command: command, Err: err}
+}
+
+// errorSeverity orders the errors from the least to the most severe: failed
+// assertions, failed build steps, invalid configurations and errors of the
+// docker daemon.
+func errorSeverity(err error) int {
+	var (
+		daemonErr    *DaemonError
+		configErr    *ConfigError
+		buildStepErr *BuildStepError
+	)
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &daemonErr):
+		return 4
+	case errors.As(err, &configErr):
+		return 3
+	case errors.As(err, &buildStepErr):
+		return 2
+	default:
+		return 1
+	}
+}
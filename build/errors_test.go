@@ -0,0 +1,51 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStepError(t *testing.T) {
+	ref := &assertionRef{
+		block:  &BlockResult{Position: "@AFTER", DockerfileRef: "RUN_USERADD"},
+		result: &AssertionResult{Assertion: "ASSERT_TRUE USER_EXISTS mario", Line: 2},
+	}
+
+	err := stepError(3, "RUN false", nil, fmt.Errorf("non-zero exit code: 1"))
+	if e, ok := err.(*BuildStepError); !ok || e.Step != 3 || e.Command != "RUN false" {
+		t.Errorf("Expected a BuildStepError for step 3, found %#v", err)
+	}
+
+	err = stepError(4, "EPHEMERAL id mario", ref, fmt.Errorf("non-zero exit code: 1"))
+	if e, ok := err.(*AssertionFailedError); !ok || e.Step != 4 || e.Line != 2 || e.Block != "@AFTER RUN_USERADD" {
+		t.Errorf("Expected an AssertionFailedError for step 4, found %#v", err)
+	}
+
+	err = stepError(5, "COPY foo /", nil, fmt.Errorf("unable to copy to container: %w", daemonErrorf("unable to make request")))
+	var daemonErr *DaemonError
+	if !errors.As(err, &daemonErr) || daemonErr.Step != 5 || daemonErr.Command != "COPY foo /" {
+		t.Errorf("Expected a DaemonError for step 5, found %#v", err)
+	}
+
+	err = stepError(0, "FROM", nil, configErrorf("FROM requires exactly one argument"))
+	if _, ok := err.(*ConfigError); !ok {
+		t.Errorf("Expected a ConfigError, found %#v", err)
+	}
+}
+
+func TestErrorSeverity(t *testing.T) {
+	errs := []error{
+		nil,
+		&AssertionFailedError{Err: fmt.Errorf("failed")},
+		&BuildStepError{Err: fmt.Errorf("failed")},
+		configErrorf("invalid"),
+		fmt.Errorf("unable to initialize builder: %w", daemonErrorf("unreachable")),
+	}
+
+	for i := 1; i < len(errs); i++ {
+		if errorSeverity(errs[i-1]) >= errorSeverity(errs[i]) {
+			t.Errorf("Expected %v to be less severe than %v", errs[i-1], errs[i])
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package build
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonEvent is the encoding of an event in a JSON lines event stream.
+type jsonEvent struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Dockerfile string    `json:"dockerfile"`
+	ImageID    string    `json:"image_id,omitempty"`
+	Step       *int      `json:"step,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	Block      string    `json:"block,omitempty"`
+	Assertion  string    `json:"assertion,omitempty"`
+	Line       int       `json:"line,omitempty"`
+	Duration   *float64  `json:"duration,omitempty"`
+	Failure    string    `json:"failure,omitempty"`
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Cached     bool      `json:"cached,omitempty"`
+}
+
+// jsonReporter writes every event as a JSON object on its own line.
+type jsonReporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONReporter returns a reporter writing a newline delimited JSON stream
+// of the build and test events to out. Durations are in seconds.
+func NewJSONReporter(out io.Writer) Reporter {
+	return &jsonReporter{encoder: json.NewEncoder(out)}
+}
+
+func (r *jsonReporter) Event(event *Event) {
+	encoded := jsonEvent{
+		Type:       event.Type,
+		Time:       event.Time,
+		Dockerfile: event.Dockerfile,
+		ImageID:    event.ImageID,
+		Command:    event.Command,
+		Block:      event.Block,
+		Assertion:  event.Assertion,
+		Line:       event.Line,
+		Failure:    event.Failure,
+		Stdout:     event.Stdout,
+		Stderr:     event.Stderr,
+		Cached:     event.Cached,
+	}
+
+	switch event.Type {
+	case EventStepStarted, EventStepFinished, EventCacheHit:
+		step := event.Step
+		encoded.Step = &step
+	}
+
+	switch event.Type {
+	case EventStepFinished, EventAssertionPassed, EventAssertionFailed:
+		duration := event.Duration.Seconds()
+		encoded.Duration = &duration
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Errors are ignored: a broken event stream must not fail the build.
+	r.encoder.Encode(encoded)
+}
+
+func (r *jsonReporter) Finish(results *TestResults) {}
+
+func (r *jsonReporter) Close() error {
+	return nil
+}
@@ -9,13 +9,12 @@ import (
 	"os"
 	"path/filepath"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/jlhawn/tarsum"
 	"github.com/l0rd/docker-unit/build/commands"
 )
 
 func (b *Builder) handleExtract(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Extract, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Extract, args)
 
 	if len(args) != 2 {
 		return fmt.Errorf("%s requires exactly two arguments", commands.Extract)
@@ -27,11 +26,11 @@ func (b *Builder) handleExtract(args []string, heredoc string) error {
 
 	containerID, err := b.createContainer([]string{"/bin/sh", "-c"}, []string{"#(nop)"}, false)
 	if err != nil {
-		return fmt.Errorf("unable to create container: %s", err)
+		return daemonErrorf("unable to create container: %s", err)
 	}
 
 	if err := b.extractToContainer(args[0], containerID, args[1]); err != nil {
-		return fmt.Errorf("unable to copy to container: %s", err)
+		return fmt.Errorf("unable to copy to container: %w", err)
 	}
 
 	b.containerID = containerID
@@ -44,19 +43,19 @@ func (b *Builder) checkExtractCache(srcPath string) bool {
 
 	srcArchive, err := os.Open(srcPath)
 	if err != nil {
-		log.Debugf("unable to open source archive: %s", err)
+		b.logger.Debugf("unable to open source archive: %s", err)
 		return false
 	}
 	defer srcArchive.Close()
 
 	digester, err := tarsum.NewDigest(tarsum.Version1)
 	if err != nil {
-		log.Debugf("unable to get new tarsum digester: %s", err)
+		b.logger.Debugf("unable to get new tarsum digester: %s", err)
 		return false
 	}
 
 	if _, err := io.Copy(digester, srcArchive); err != nil {
-		log.Debugf("unable to digest source archive: %s", err)
+		b.logger.Debugf("unable to digest source archive: %s", err)
 		return false
 	}
 
@@ -81,14 +80,14 @@ func (b *Builder) extractToContainer(srcPath, dstContainer, dstDir string) (err
 	urlPath := fmt.Sprintf("/containers/%s/extract-to-dir?%s", dstContainer, query.Encode())
 	req, err := http.NewRequest("PUT", b.client.URL.String()+urlPath, srcArchive)
 	if err != nil {
-		return fmt.Errorf("unable to prepare request: %s", err)
+		return daemonErrorf("unable to prepare request: %s", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-tar")
 
 	resp, err := b.client.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to make request: %s", err)
+		return daemonErrorf("unable to make request: %s", err)
 	}
 	defer resp.Body.Close()
 
@@ -2,8 +2,8 @@ package build
 
 import (
 	"fmt"
+	"net/url"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/l0rd/docker-unit/build/commands"
 	"github.com/samalba/dockerclient"
 )
@@ -14,7 +14,7 @@ const (
 )
 
 func (b *Builder) handleFrom(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.From, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.From, args)
 
 	if len(args) != 1 {
 		return fmt.Errorf("%s requires exactly one argument", commands.From)
@@ -23,7 +23,7 @@ func (b *Builder) handleFrom(args []string, heredoc string) error {
 	imageName := args[0]
 
 	if imageName == fromScratch {
-		log.Debugf("building image from scratch")
+		b.logger.Debugf("building image from scratch")
 
 		b.imageID = ""
 		b.mergeConfig(nil)
@@ -37,25 +37,28 @@ func (b *Builder) handleFrom(args []string, heredoc string) error {
 		b.imageID = info.Id
 		b.mergeConfig(info.Config)
 
-		log.Debugf("got image ID: %s", b.imageID)
+		b.logger.Debugf("got image ID: %s", b.imageID)
 
 		return nil
 	}
 
 	if err != dockerclient.ErrNotFound {
-		fmt.Errorf("unable to inspect image: %s", err)
+		return daemonErrorf("unable to inspect image: %s", err)
 	}
 
 	// Need to pull the image.
 	fmt.Fprintln(b.out, "pulling image ...")
 	if err := b.client.PullImage(imageName, nil); err != nil {
+		if _, ok := err.(*url.Error); ok {
+			return daemonErrorf("unable to pull image: %s", err)
+		}
 		return fmt.Errorf("unable to pull image: %s", err)
 	}
 
 	// Inspect to get the ID.
 	info, err = b.client.InspectImage(imageName)
 	if err != nil {
-		return fmt.Errorf("unable to inspect image: %s", err)
+		return daemonErrorf("unable to inspect image: %s", err)
 	}
 
 	b.imageID = info.Id
@@ -5,7 +5,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/l0rd/docker-unit/build/commands"
 )
 
@@ -26,7 +25,7 @@ func (b *Builder) handleOnbuild(args []string, heredoc string) error {
  ***********************/
 
 func (b *Builder) handleCmd(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Cmd, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Cmd, args)
 
 	b.config.Cmd = args
 
@@ -34,7 +33,7 @@ func (b *Builder) handleCmd(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleEntrypoint(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Entrypoint, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Entrypoint, args)
 
 	b.config.Entrypoint = args
 
@@ -42,7 +41,7 @@ func (b *Builder) handleEntrypoint(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleEnv(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Env, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Env, args)
 
 	if len(args) != 2 {
 		return fmt.Errorf("%s requires exactly two arguments", commands.Env)
@@ -54,7 +53,7 @@ func (b *Builder) handleEnv(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleExpose(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Expose, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Expose, args)
 
 	if len(args) != 1 {
 		return fmt.Errorf("%s requires exactly one argument", commands.Expose)
@@ -66,7 +65,7 @@ func (b *Builder) handleExpose(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleLabel(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Label, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Label, args)
 
 	if len(args) != 2 {
 		return fmt.Errorf("%s requires exactly two arguments", commands.Label)
@@ -78,7 +77,7 @@ func (b *Builder) handleLabel(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleMaintainer(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Maintainer, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Maintainer, args)
 
 	if len(args) < 1 {
 		return fmt.Errorf("%s requires at least one argument", commands.Maintainer)
@@ -90,7 +89,7 @@ func (b *Builder) handleMaintainer(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleUser(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.User, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.User, args)
 
 	if len(args) != 1 {
 		return fmt.Errorf("%s requires exactly one argument", commands.User)
@@ -102,7 +101,7 @@ func (b *Builder) handleUser(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleVolume(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Volume, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Volume, args)
 
 	if len(args) == 0 {
 		return fmt.Errorf("%s requires at least one argument", commands.Volume)
@@ -121,7 +120,7 @@ func (b *Builder) handleVolume(args []string, heredoc string) error {
 }
 
 func (b *Builder) handleWorkdir(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Workdir, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Workdir, args)
 
 	if len(args) != 1 {
 		return fmt.Errorf("%s requires exactly one argument", commands.Workdir)
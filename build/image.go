@@ -0,0 +1,200 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// historyLayer is a layer of the history of an image along with the
+// reference of the Dockerfile instruction that created it.
+type historyLayer struct {
+	imageID string
+	ref     string
+}
+
+// testImage runs the tests of the test file against an existing image
+// instead of building the Dockerfile.
+func (b *Builder) testImage() error {
+	tester, err := b.parseTests()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b.out, "Testing image %s\n", b.image)
+
+	if err := b.handleFrom([]string{b.image}, ""); err != nil {
+		var daemonErr *DaemonError
+		if errors.As(err, &daemonErr) {
+			return err
+		}
+		return configErrorf("unable to get image %s: %s", b.image, err)
+	}
+
+	b.testResults.ImageID = b.imageID
+	b.testResults.ImageName = b.image
+
+	var layers []historyLayer
+	if b.checkHistory {
+		if layers, err = b.imageHistory(); err != nil {
+			return err
+		}
+	}
+
+	for i, testBlock := range tester.testBlocks {
+		switch testBlock.Position {
+		case commands.AfterRun, commands.AfterRunExit:
+			continue
+		case commands.Before, commands.After:
+			if b.checkHistory {
+				if err := b.runHistoryTestBlock(i, testBlock, layers); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		b.skipTestBlock(i, "not applicable without building the Dockerfile")
+	}
+
+	if err := b.dispatchPostBuildTests(); err != nil {
+		return err
+	}
+
+	// The tests went on after a failed assertion was debugged.
+	return b.debuggedFailure
+}
+
+// imageHistory returns the layers of the image, from the oldest to the most
+// recent one.
+func (b *Builder) imageHistory() ([]historyLayer, error) {
+	history, err := b.client2.ImageHistory(b.imageID)
+	if err != nil {
+		return nil, daemonErrorf("unable to get image history: %s", err)
+	}
+
+	layers := make([]historyLayer, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		imageID := history[i].ID
+		if imageID == "<missing>" {
+			imageID = ""
+		}
+		layers = append(layers, historyLayer{imageID: imageID, ref: historyRef(history[i].CreatedBy)})
+	}
+
+	return layers, nil
+}
+
+// historyRef returns the reference of the Dockerfile instruction that created
+// a layer, as it would be written in a test file, from the command recorded
+// in the image history.
+func historyRef(createdBy string) string {
+	instruction := strings.TrimSpace(strings.TrimSuffix(createdBy, "# buildkit"))
+
+	switch {
+	case strings.HasPrefix(instruction, "/bin/sh -c #(nop) "):
+		instruction = strings.TrimSpace(strings.TrimPrefix(instruction, "/bin/sh -c #(nop) "))
+	case strings.HasPrefix(instruction, "/bin/sh -c "):
+		instruction = commands.Run + " " + strings.TrimPrefix(instruction, "/bin/sh -c ")
+	case strings.HasPrefix(instruction, commands.Run+" /bin/sh -c "):
+		instruction = commands.Run + " " + strings.TrimPrefix(instruction, commands.Run+" /bin/sh -c ")
+	default:
+		if _, ok := commands.Commands[strings.ToUpper(strings.SplitN(instruction, " ", 2)[0])]; !ok {
+			instruction = commands.Run + " " + instruction
+		}
+	}
+
+	cmds, err := parser.Parse(strings.NewReader(instruction))
+	if err != nil || len(cmds) != 1 {
+		return strings.ToUpper(strings.Replace(instruction, " ", "_", -1))
+	}
+
+	return toDockerfileRef(cmds[0])
+}
+
+// runHistoryTestBlock runs the assertions of a @BEFORE or @AFTER block in
+// containers created from the layer of the image history preceding or
+// following the Dockerfile instruction the block refers to.
+func (b *Builder) runHistoryTestBlock(index int, testBlock TestBlock, layers []historyLayer) error {
+	imageID, found := "", false
+	for i, layer := range layers {
+		if !strings.HasPrefix(layer.ref, testBlock.DockerfileRef) {
+			continue
+		}
+
+		found = true
+		if testBlock.Position == commands.After {
+			imageID = layer.imageID
+		} else if i > 0 {
+			imageID = layers[i-1].imageID
+		}
+		break
+	}
+
+	switch {
+	case !found:
+		b.skipTestBlock(index, "no matching layer in the image history")
+		return nil
+	case imageID == "":
+		b.skipTestBlock(index, "layer not available locally")
+		return nil
+	}
+
+	fmt.Fprintf(b.out, "\nHistory Test %d: %s %s against layer %s\n", index, testBlock.Position, testBlock.DockerfileRef, imageID)
+
+	for j, ephemeral := range testBlock.Ephemerals {
+		ref := assertionRef{
+			block:  b.testResults.Blocks[index],
+			result: b.testResults.Blocks[index].Assertions[j],
+		}
+
+		switch ephemeral.Args[0] {
+		case commands.Ephemeral, commands.Snapshot, commands.CheckFile:
+		default:
+			b.skipAssertion(ref, "not applicable without building the Dockerfile")
+			continue
+		}
+
+		start := time.Now()
+
+		b.startAssertion(ref)
+		var err error
+		switch ephemeral.Args[0] {
+		case commands.Snapshot:
+			err = b.checkSnapshot(imageID, ephemeral.Args[3], ephemeral.Args[4:], ref.result)
+		case commands.CheckFile:
+			err = b.withImageContainer(imageID, func(containerID string) error {
+				return b.checkFile(containerID, &parser.Command{Args: ephemeral.Args[1:]}, ref.result)
+			})
+		default:
+			err = b.runLeftBehindTest(imageID, ephemeral.Args[1:], ref.result)
+		}
+		b.finishAssertion(ref, start, err)
+
+		if err != nil {
+			return stepError(-1, ref.result.Assertion, &ref, err)
+		}
+	}
+
+	return nil
+}
+
+// skipTestBlock reports every assertion of a test block as skipped.
+func (b *Builder) skipTestBlock(index int, reason string) {
+	block := b.testResults.Blocks[index]
+	for _, result := range block.Assertions {
+		b.skipAssertion(assertionRef{block: block, result: result}, reason)
+	}
+}
+
+// skipAssertion reports an assertion as skipped for the given reason.
+func (b *Builder) skipAssertion(ref assertionRef, reason string) {
+	ref.result.Status = StatusSkipped
+	ref.result.SkipReason = reason
+
+	fmt.Fprintf(b.out, " --- %s: %s (%s)\n", StatusSkipped, ref.result.Assertion, reason)
+}
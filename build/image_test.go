@@ -0,0 +1,78 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestHistoryRef(t *testing.T) {
+	cases := map[string]string{
+		"/bin/sh -c #(nop)  ENV FOO=bar":                   "ENV_FOO=BAR",
+		"/bin/sh -c #(nop) CMD [\"nginx\"]":                "CMD_[NGINX]",
+		"/bin/sh -c apt-get install -y curl":               "RUN_APT-GET_INSTALL_-Y_CURL",
+		"RUN /bin/sh -c useradd mario # buildkit":          "RUN_USERADD_MARIO",
+		"COPY words /usr/local/tomcat/webapps/ # buildkit": "COPY_WORDS_/USR/LOCAL/TOMCAT/WEBAPPS/",
+		"useradd -d /home/mario mario":                     "RUN_USERADD_-D_/HOME/MARIO_MARIO",
+	}
+
+	for createdBy, expected := range cases {
+		if ref := historyRef(createdBy); ref != expected {
+			t.Errorf("historyRef(%q) == %q, expected %q", createdBy, ref, expected)
+		}
+	}
+}
+
+func TestNewBuilderWithImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-unit")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// No Dockerfile is needed to test an existing image.
+	b, err := NewBuilder(dir,
+		WithDaemon("tcp://127.0.0.1:2376", nil),
+		WithImage("nginx:1.9"),
+		WithHistory(true),
+		WithTestFileReader("inline", strings.NewReader("@AFTER_RUN\nASSERT_TRUE PROCESS_EXISTS nginx\n")),
+		WithCacheFile(filepath.Join(dir, "cache")),
+		WithOutput(ioutil.Discard),
+	)
+	if err != nil {
+		t.Fatalf("unable to create builder: %s", err)
+	}
+	if b.image != "nginx:1.9" || !b.checkHistory {
+		t.Errorf("Unexpected image options: %s, %t", b.image, b.checkHistory)
+	}
+
+	if _, err := NewBuilder(dir, WithImage("nginx:1.9"), WithOutput(ioutil.Discard)); err == nil {
+		t.Errorf("Expected an error testing an image without a test file")
+	}
+	if _, err := NewBuilder(dir, WithOutput(ioutil.Discard)); err == nil {
+		t.Errorf("Expected an error building without a Dockerfile")
+	}
+}
+
+func TestTestImageReturnsDebuggedFailure(t *testing.T) {
+	debugged := &AssertionFailedError{Err: errors.New("expected process nginx to exist")}
+	b := &Builder{
+		out:             &bytes.Buffer{},
+		logger:          log.New(),
+		config:          &config{},
+		image:           fromScratch,
+		dockerTestfile:  []byte("@AFTER RUN_APT-GET\nASSERT_TRUE IS_INSTALLED 'nginx'\n"),
+		testResults:     &TestResults{},
+		debuggedFailure: debugged,
+	}
+
+	if err := b.testImage(); err != debugged {
+		t.Errorf("Expected the debugged failure to be returned, found %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package build
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	File      string          `xml:"file,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// WriteJUnitReport writes the results of one or more Dockerfiles as a JUnit
+// XML report, with one testsuite per Dockerfile and one testcase per
+// assertion.
+func WriteJUnitReport(w io.Writer, results []*TestResults) error {
+	report := junitTestSuites{}
+
+	for _, testResults := range results {
+		suite := junitTestSuite{
+			Name: testResults.DockerfilePath,
+			Time: junitTime(testResults.Duration),
+			File: testResults.TestfilePath,
+		}
+
+		for _, block := range testResults.Blocks {
+			for _, assertion := range block.Assertions {
+				testCase := junitTestCase{
+					Name:      assertion.Assertion,
+					ClassName: block.Name(),
+					File:      testResults.TestfilePath,
+					Line:      assertion.Line,
+					Time:      junitTime(assertion.Duration),
+					SystemOut: assertion.Stdout,
+					SystemErr: assertion.Stderr,
+				}
+
+				switch assertion.Status {
+				case StatusFailed:
+					suite.Failures++
+					testCase.Failure = &junitFailure{
+						Message:  assertion.Failure,
+						Contents: junitFailureContents(testResults.TestfilePath, assertion),
+					}
+				case StatusSkipped:
+					suite.Skipped++
+					testCase.Skipped = &junitSkipped{Message: assertion.SkipReason}
+				}
+
+				suite.Tests++
+				suite.TestCases = append(suite.TestCases, testCase)
+			}
+		}
+
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("unable to write JUnit report: %s", err)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("unable to encode JUnit report: %s", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// junitReporter collects the results of every Dockerfile and writes them as a
+// JUnit XML report when closed.
+type junitReporter struct {
+	out     io.Writer
+	mu      sync.Mutex
+	results []*TestResults
+}
+
+// NewJUnitReporter returns a reporter writing a JUnit XML report to out.
+func NewJUnitReporter(out io.Writer) Reporter {
+	return &junitReporter{out: out}
+}
+
+func (r *junitReporter) Event(event *Event) {}
+
+func (r *junitReporter) Finish(results *TestResults) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, results)
+}
+
+func (r *junitReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return WriteJUnitReport(r.out, r.results)
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func junitFailureContents(testfilePath string, assertion *AssertionResult) string {
+	contents := []string{
+		fmt.Sprintf("%s:%d: %s", testfilePath, assertion.Line, assertion.Assertion),
+		assertion.Failure,
+	}
+
+	if assertion.Stdout != "" {
+		contents = append(contents, "stdout:", assertion.Stdout)
+	}
+	if assertion.Stderr != "" {
+		contents = append(contents, "stderr:", assertion.Stderr)
+	}
+
+	return strings.Join(contents, "\n")
+}
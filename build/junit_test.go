@@ -0,0 +1,56 @@
+package build
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	tests, err := newTester("testfile")
+	if err != nil {
+		t.Fatalf("Error creating newTester: %s", err)
+	}
+
+	results := &TestResults{DockerfilePath: "dockerfile", TestfilePath: "testfile", Blocks: newBlockResults(tests)}
+	results.Duration = 2 * time.Second
+
+	passed := results.Blocks[0].Assertions[0]
+	passed.Status = StatusPassed
+	passed.Duration = 1500 * time.Millisecond
+
+	failed := results.Blocks[1].Assertions[0]
+	failed.Status = StatusFailed
+	failed.Failure = "non-zero exit code: 1"
+	failed.Stdout = "/usr/local/tomcat/webapps/words"
+
+	var buf bytes.Buffer
+	if err := WriteJUnitReport(&buf, []*TestResults{results}); err != nil {
+		t.Fatalf("unable to write JUnit report: %s", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("unable to decode JUnit report: %s\n%s", err, buf.String())
+	}
+
+	if len(report.Suites) != 1 {
+		t.Fatalf("Expected 1 testsuite, found %d", len(report.Suites))
+	}
+
+	suite := report.Suites[0]
+	if suite.Tests != 8 || suite.Failures != 1 || suite.Skipped != 6 {
+		t.Errorf("Expected 8 tests, 1 failure and 6 skipped, found %d, %d and %d", suite.Tests, suite.Failures, suite.Skipped)
+	}
+
+	first := suite.TestCases[0]
+	if first.ClassName != "@AFTER RUN_USERADD" || first.Line != 2 || first.Time != "1.500" || first.Failure != nil {
+		t.Errorf("Unexpected first testcase: %+v", first)
+	}
+
+	second := suite.TestCases[1]
+	if second.Line != 5 || second.Failure == nil || second.Failure.Message != failed.Failure || second.SystemOut != failed.Stdout {
+		t.Errorf("Unexpected second testcase: %+v", second)
+	}
+}
@@ -0,0 +1,98 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+)
+
+// failureRepository is the repository of the images the containers of the
+// failed assertions are committed to with --keep-on-failure.
+const failureRepository = "cunit-failure"
+
+// invalidRepositoryChars matches what a test block name has and a repository
+// name cannot have.
+var invalidRepositoryChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// keepFailure commits the container an assertion failed in to the image
+// cunit-failure/<block>:<run-id>, and prints how to inspect it. The
+// assertions checking the files of an image, which leave no container, get
+// the image they ran against tagged instead. Nothing is done for a daemon or
+// configuration error, and a failure to keep the container is only printed:
+// the error of the assertion matters more.
+func (b *Builder) keepFailure(ref *assertionRef, containerID, imageID string, err error) {
+	var assertionErr *AssertionFailedError
+	if !b.keepOnFailure || ref == nil || (containerID == "" && imageID == "") || !errors.As(err, &assertionErr) {
+		return
+	}
+
+	repository := failureRepository + "/" + failureImageName(ref.block.Name())
+	name := repository + ":" + b.runID
+
+	var keepErr error
+	if containerID != "" {
+		imageID, keepErr = b.commitFailure(containerID, repository, fmt.Sprintf("%s line %d: %s", ref.block.Name(), ref.result.Line, ref.result.Assertion))
+	} else {
+		keepErr = b.client2.TagImage(imageID, dockerclient2.TagImageOptions{Repo: repository, Tag: b.runID})
+	}
+	if keepErr != nil {
+		fmt.Fprintf(b.out, " unable to keep the state of the failed assertion: %s\n", keepErr)
+		return
+	}
+
+	fmt.Fprintf(b.out, " kept the state of the failed assertion as %s (%s), inspect it with:\n", name, shortID(imageID))
+	fmt.Fprintf(b.out, "     docker run --rm -it --entrypoint /bin/sh %s\n", name)
+	fmt.Fprintf(b.out, "   and remove it with:\n")
+	fmt.Fprintf(b.out, "     docker rmi %s\n", name)
+}
+
+// commitFailure commits a container to the repository and returns the ID of
+// the image. The run label of the container is emptied: the daemon merges the
+// labels of the container into the image, and the containers started from it
+// must not be removed by RemoveLeftovers.
+func (b *Builder) commitFailure(containerID, repository, message string) (string, error) {
+	container, err := b.client2.InspectContainer(containerID)
+	if err != nil {
+		return "", err
+	}
+
+	config := container.Config
+	if config == nil {
+		config = &dockerclient2.Config{}
+	}
+	labels := map[string]string{runLabel: ""}
+	for key, value := range config.Labels {
+		if key != runLabel {
+			labels[key] = value
+		}
+	}
+	config.Labels = labels
+
+	image, err := b.client2.CommitContainer(dockerclient2.CommitContainerOptions{
+		Container:  containerID,
+		Repository: repository,
+		Tag:        b.runID,
+		Message:    message,
+		Run:        config,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return image.ID, nil
+}
+
+// failureImageName returns the name of a test block as a repository name:
+//
+//	@AFTER RUN_APT-GET -> after-run-apt-get
+func failureImageName(block string) string {
+	name := strings.Trim(invalidRepositoryChars.ReplaceAllString(strings.ToLower(block), "-"), "-")
+	if name == "" {
+		return "block"
+	}
+
+	return name
+}
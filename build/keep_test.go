@@ -0,0 +1,106 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+)
+
+func TestFailureImageName(t *testing.T) {
+	names := map[string]string{
+		"@AFTER RUN_APT-GET": "after-run-apt-get",
+		"@AFTER_RUN":         "after-run",
+		"@BEFORE COPY":       "before-copy",
+		"@":                  "block",
+	}
+
+	for block, expected := range names {
+		if name := failureImageName(block); name != expected {
+			t.Errorf("Expected the image name of %s to be %s, found %s", block, expected, name)
+		}
+	}
+}
+
+// newFakeDaemon returns a builder whose client2 talks to a daemon answering
+// the requests of keepFailure, and the requests it received.
+func newFakeDaemon(t *testing.T) (*Builder, *[]*http.Request, *dockerclient2.Config, func()) {
+	var (
+		requests  []*http.Request
+		committed dockerclient2.Config
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/json"):
+			json.NewEncoder(w).Encode(dockerclient2.Container{ID: "c1", Config: &dockerclient2.Config{
+				Cmd:    []string{"test", "-f", "/etc/app.conf"},
+				Labels: map[string]string{runLabel: "0123456789ab", "maintainer": "cunit"},
+			}})
+		case r.URL.Path == "/commit":
+			json.NewDecoder(r.Body).Decode(&committed)
+			json.NewEncoder(w).Encode(dockerclient2.Image{ID: "sha256:0123456789abcdef"})
+		}
+	}))
+
+	client, err := dockerclient2.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+
+	b := &Builder{out: &bytes.Buffer{}, client2: client, runID: "0123456789ab", keepOnFailure: true}
+
+	return b, &requests, &committed, server.Close
+}
+
+func TestKeepFailure(t *testing.T) {
+	ref := &assertionRef{block: &BlockResult{Position: "@AFTER", DockerfileRef: "COPY"}, result: &AssertionResult{Assertion: "ASSERT_TRUE FILE_EXISTS '/etc/app.conf'"}}
+	assertionErr := &AssertionFailedError{Err: errors.New("expected /etc/app.conf to exist")}
+
+	b, requests, committed, closeServer := newFakeDaemon(t)
+	defer closeServer()
+
+	b.keepFailure(ref, "c1", "sha256:1", assertionErr)
+	if len(*requests) != 2 || (*requests)[1].URL.Path != "/commit" {
+		t.Fatalf("Expected the container to be inspected and committed, found %d requests", len(*requests))
+	}
+	if query := (*requests)[1].URL.Query(); query.Get("repo") != "cunit-failure/after-copy" || query.Get("tag") != "0123456789ab" {
+		t.Errorf("Unexpected commit of the container: %s", (*requests)[1].URL.RawQuery)
+	}
+	if committed.Labels[runLabel] != "" || committed.Labels["maintainer"] != "cunit" || len(committed.Cmd) != 3 {
+		t.Errorf("Expected the run label of the committed configuration to be emptied, found %+v", committed)
+	}
+	if !strings.Contains(b.out.(*bytes.Buffer).String(), "kept the state of the failed assertion as cunit-failure/after-copy:0123456789ab") {
+		t.Errorf("Unexpected output: %s", b.out)
+	}
+
+	*requests = nil
+	b.keepFailure(ref, "", "sha256:1", assertionErr)
+	if len(*requests) != 1 || (*requests)[0].URL.Path != "/images/sha256:1/tag" {
+		t.Errorf("Expected the image of an assertion without container to be tagged, found %d requests", len(*requests))
+	}
+}
+
+func TestKeepFailureGating(t *testing.T) {
+	ref := &assertionRef{block: &BlockResult{Position: "@AFTER_RUN"}, result: &AssertionResult{Assertion: "ASSERT_TRUE PROCESS_EXISTS 'nginx'"}}
+	assertionErr := &AssertionFailedError{Err: errors.New("expected process nginx to exist")}
+
+	b, requests, _, closeServer := newFakeDaemon(t)
+	defer closeServer()
+
+	b.keepFailure(ref, "c1", "sha256:1", daemonErrorf("unable to create container"))
+	b.keepFailure(ref, "c1", "sha256:1", configErrorf("invalid test file"))
+	b.keepFailure(ref, "", "", assertionErr)
+	b.keepFailure(nil, "c1", "sha256:1", assertionErr)
+	b.keepOnFailure = false
+	b.keepFailure(ref, "c1", "sha256:1", assertionErr)
+
+	if len(*requests) != 0 || b.out.(*bytes.Buffer).Len() != 0 {
+		t.Errorf("Expected nothing to be kept, found %d requests and output %q", len(*requests), b.out)
+	}
+}
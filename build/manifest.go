@@ -0,0 +1,196 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+	"github.com/l0rd/docker-unit/build/util"
+)
+
+// LoadManifest reads a JSON manifest file mapping Dockerfile paths (or the
+// directories that contain them) relative to the root of a directory tree to
+// the repository name and tag of the image they build:
+//
+//	{
+//		"base/Dockerfile": "myorg/base:latest",
+//		"web": "myorg/web:1.0"
+//	}
+func LoadManifest(manifestPath string) (map[string]string, error) {
+	manifestFile, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open manifest file: %s", err)
+	}
+	defer manifestFile.Close()
+
+	repoTags := map[string]string{}
+	if err := json.NewDecoder(manifestFile).Decode(&repoTags); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest file: %s", err)
+	}
+
+	return repoTags, nil
+}
+
+// ParseRepoTags parses a comma separated list of <path>=<repo[:tag]> pairs
+// into the same kind of map returned by LoadManifest.
+func ParseRepoTags(list string) (map[string]string, error) {
+	repoTags := map[string]string{}
+
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid repository tag %q: expected <path>=<repo[:tag]>", pair)
+		}
+
+		repoTags[parts[0]] = parts[1]
+	}
+
+	return repoTags, nil
+}
+
+// AssignRepoTags sets the repository tag of the targets found under root.
+// The keys of repoTags are either the path of a Dockerfile or the path of its
+// directory, relative to root. Every key must match a target.
+func AssignRepoTags(root string, targets []Target, repoTags map[string]string) error {
+	for key, repoTag := range repoTags {
+		repo, tag := util.ParseRepositoryTag(repoTag)
+		if err := util.ValidateRepositoryName(repo); err != nil {
+			return fmt.Errorf("invalid repository name for %s: %s", key, err)
+		}
+		if tag != "" {
+			if err := util.ValidateTagName(tag); err != nil {
+				return fmt.Errorf("invalid tag for %s: %s", key, err)
+			}
+		}
+
+		keyPath := filepath.Clean(filepath.Join(root, key))
+
+		matched := false
+		for i := range targets {
+			if targets[i].DockerfilePath == keyPath || (targets[i].ContextDirectory == keyPath && isDefaultDockerfile(targets[i])) {
+				targets[i].RepoTag = repoTag
+				matched = true
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("no tested Dockerfile found for %s", key)
+		}
+	}
+
+	return nil
+}
+
+func isDefaultDockerfile(target Target) bool {
+	return filepath.Base(target.DockerfilePath) == "Dockerfile"
+}
+
+// parseBaseImage returns the image named by the FROM instruction of a
+// Dockerfile.
+func parseBaseImage(dockerfilePath string) (string, error) {
+	dockerfile, err := os.Open(dockerfilePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to open Dockerfile: %s", err)
+	}
+	defer dockerfile.Close()
+
+	cmds, err := parser.Parse(dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse Dockerfile: %s", err)
+	}
+
+	if len(cmds) == 0 || strings.ToUpper(cmds[0].Args[0]) != commands.From || len(cmds[0].Args) != 2 {
+		return "", fmt.Errorf("%s must start with a single argument FROM instruction", dockerfilePath)
+	}
+
+	return cmds[0].Args[1], nil
+}
+
+// normalizeImageName appends the default "latest" tag to image names that do
+// not specify a tag or a digest.
+func normalizeImageName(name string) string {
+	repo, tag := util.ParseRepositoryTag(name)
+	if tag == "" {
+		tag = "latest"
+	}
+	if strings.Contains(name, "@") {
+		return repo + "@" + tag
+	}
+
+	return repo + ":" + tag
+}
+
+// targetDependencies returns, for every target, the indexes of the targets
+// that build the image it is based on. An error is returned if the
+// dependencies contain a cycle.
+func targetDependencies(targets []Target) ([][]int, error) {
+	builtBy := map[string]int{}
+	for i, target := range targets {
+		if target.RepoTag == "" {
+			continue
+		}
+
+		name := normalizeImageName(target.RepoTag)
+		if j, exists := builtBy[name]; exists {
+			return nil, fmt.Errorf("image %s is built by both %s and %s", name, targets[j].DockerfilePath, target.DockerfilePath)
+		}
+		builtBy[name] = i
+	}
+
+	deps := make([][]int, len(targets))
+	for i, target := range targets {
+		baseImage, err := parseBaseImage(target.DockerfilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if j, exists := builtBy[normalizeImageName(baseImage)]; exists {
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	// Detect cycles with a depth first search.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(targets))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected involving %s", targets[i].DockerfilePath)
+		case visited:
+			return nil
+		}
+
+		state[i] = visiting
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+
+		return nil
+	}
+
+	for i := range targets {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
@@ -0,0 +1,103 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTargets(t *testing.T, root string, dockerfiles map[string]string) []Target {
+	for file, content := range dockerfiles {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unable to create dir: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unable to create file: %s", err)
+		}
+		if err := ioutil.WriteFile(path+"_test", []byte("@AFTER_RUN\nASSERT_TRUE FILE_EXISTS '/etc/passwd'\n"), 0644); err != nil {
+			t.Fatalf("unable to create file: %s", err)
+		}
+	}
+
+	targets, err := Discover(root)
+	if err != nil {
+		t.Fatalf("unable to discover Dockerfiles: %s", err)
+	}
+
+	return targets
+}
+
+func TestTargetDependencies(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-unit-manifest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	targets := writeTargets(t, root, map[string]string{
+		"app/Dockerfile":  "FROM myorg/base\nRUN true\n",
+		"base/Dockerfile": "FROM debian:jessie\n",
+		"tool/Dockerfile": "FROM myorg/app:1.0\n",
+	})
+
+	repoTags, err := ParseRepoTags("base=myorg/base:latest, app/Dockerfile=myorg/app:1.0")
+	if err != nil {
+		t.Fatalf("unable to parse repository tags: %s", err)
+	}
+
+	if err := AssignRepoTags(root, targets, repoTags); err != nil {
+		t.Fatalf("unable to assign repository tags: %s", err)
+	}
+
+	deps, err := targetDependencies(targets)
+	if err != nil {
+		t.Fatalf("unable to compute dependencies: %s", err)
+	}
+
+	// Targets are sorted: app, base, tool.
+	expected := [][]int{{1}, nil, {0}}
+	for i := range expected {
+		if len(deps[i]) != len(expected[i]) || (len(deps[i]) == 1 && deps[i][0] != expected[i][0]) {
+			t.Errorf("Expected dependencies of %s to be %v, found %v", targets[i].DockerfilePath, expected[i], deps[i])
+		}
+	}
+}
+
+func TestTargetDependenciesCycle(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-unit-manifest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	targets := writeTargets(t, root, map[string]string{
+		"a/Dockerfile": "FROM myorg/bb\n",
+		"b/Dockerfile": "FROM myorg/aa\n",
+	})
+
+	if err := AssignRepoTags(root, targets, map[string]string{"a": "myorg/aa", "b": "myorg/bb"}); err != nil {
+		t.Fatalf("unable to assign repository tags: %s", err)
+	}
+
+	if _, err := targetDependencies(targets); err == nil {
+		t.Errorf("Expected a dependency cycle error")
+	}
+}
+
+func TestAssignRepoTagsUnknownPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "docker-unit-manifest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	targets := writeTargets(t, root, map[string]string{
+		"a/Dockerfile": "FROM debian\n",
+	})
+
+	if err := AssignRepoTags(root, targets, map[string]string{"missing": "myorg/missing"}); err == nil {
+		t.Errorf("Expected an error for a path that matches no Dockerfile")
+	}
+}
@@ -0,0 +1,360 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// List of the mutation operators applied to a Dockerfile.
+const (
+	mutateDropRun     = "drop-run"
+	mutateDropPackage = "drop-package"
+	mutateChangeUser  = "change-user"
+	mutateDropCopy    = "drop-copy"
+)
+
+// aptGetInstall matches the apt-get install commands of a RUN instruction,
+// with their options.
+var aptGetInstall = regexp.MustCompile(`\bapt(-get)?(\s+-\S+)*\s+install\b`)
+
+// commandWord matches a word of a shell command.
+var commandWord = regexp.MustCompile(`\S+`)
+
+// Mutant is a Dockerfile with a single change that the tests are expected to
+// detect.
+type Mutant struct {
+	Line        int
+	Operator    string
+	Description string
+	Dockerfile  []byte
+}
+
+// MutantResult is the outcome of the tests against a mutant. A mutant is
+// killed if its build or its tests fail, and invalid if its tests cannot run
+// against it, such as when a test block refers to the dropped instruction.
+// Reason is then the error. The invalid mutants are left out of the mutation
+// score.
+type MutantResult struct {
+	Mutant  *Mutant
+	Killed  bool
+	Invalid bool
+	Reason  string
+}
+
+// Mutation runs the tests of a Dockerfile against mutants of the Dockerfile
+// to find the changes the tests do not detect.
+type Mutation struct {
+	contextDirectory string
+	options          []Option
+	results          []MutantResult
+
+	out io.Writer
+}
+
+// NewMutation creates a mutation run for the Dockerfile and the test file
+// set by the options, which are used to create the builder of the original
+// Dockerfile and of every mutant. The mutants are built without repository
+// and reporters, and without updating the snapshots or checking the coverage.
+func NewMutation(contextDirectory string, options ...Option) *Mutation {
+	return &Mutation{
+		contextDirectory: contextDirectory,
+		options:          options,
+		out:              os.Stdout,
+	}
+}
+
+// Results returns the outcome of every mutant once the mutation has run.
+func (m *Mutation) Results() []MutantResult {
+	return m.results
+}
+
+// Run builds and tests the original Dockerfile, which must pass, then every
+// mutant of it, and prints which mutants survived. The build cache makes the
+// instructions preceding the mutation cheap to build.
+func (m *Mutation) Run() error {
+	var out bytes.Buffer
+	options := append([]Option{}, m.options...)
+	b, err := NewBuilder(m.contextDirectory, append(options, WithOutput(&out))...)
+	if err != nil {
+		return err
+	}
+	if b.dockerTestfilePath == "" {
+		return configErrorf("no test file found for %s", b.dockerfilePath)
+	}
+	if b.image != "" {
+		return configErrorf("mutation testing requires building the Dockerfile")
+	}
+
+	dockerfile, err := ioutil.ReadFile(b.dockerfilePath)
+	if err != nil {
+		return configErrorf("unable to read Dockerfile: %s", err)
+	}
+	mutants, err := generateMutants(dockerfile)
+	if err != nil {
+		return configErrorf("unable to parse Dockerfile: %s", err)
+	}
+
+	fmt.Fprintf(m.out, "Testing %s before mutating it\n", b.dockerfilePath)
+	if _, err := b.Test(); err != nil {
+		out.WriteTo(m.out)
+		return fmt.Errorf("the tests must pass before mutating the Dockerfile: %w", err)
+	}
+
+	testfile := WithTestFile(b.dockerTestfilePath)
+	if b.dockerTestfile != nil {
+		testfile = WithTestFileReader(b.dockerTestfilePath, bytes.NewReader(b.dockerTestfile))
+	}
+
+	fmt.Fprintf(m.out, "Testing %d mutants\n", len(mutants))
+
+	m.results = nil
+	for _, mutant := range mutants {
+		result, err := m.runMutant(mutant, testfile)
+		if err != nil {
+			return err
+		}
+		m.results = append(m.results, result)
+
+		fmt.Fprintf(m.out, "%s line %d: %s\n", result.status(), mutant.Line, mutant.Description)
+	}
+
+	m.printSummary()
+
+	return nil
+}
+
+// runMutant builds and tests a mutant. Only the errors preventing to tell
+// whether the mutant is killed, such as daemon errors, are returned.
+func (m *Mutation) runMutant(mutant *Mutant, testfile Option) (MutantResult, error) {
+	result := MutantResult{Mutant: mutant}
+
+	f, err := ioutil.TempFile("", "Dockerfile.mutant.")
+	if err != nil {
+		return result, fmt.Errorf("unable to create mutant Dockerfile: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(mutant.Dockerfile)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return result, fmt.Errorf("unable to write mutant Dockerfile: %s", err)
+	}
+
+	options := append([]Option{}, m.options...)
+	options = append(options,
+		WithDockerfile(f.Name()),
+		testfile,
+		WithRepoTag(""),
+		WithOutput(ioutil.Discard),
+		asMutant(),
+	)
+
+	b, err := NewBuilder(m.contextDirectory, options...)
+	if err != nil {
+		return result, err
+	}
+
+	_, err = b.Test()
+
+	return result, result.classify(err)
+}
+
+// classify sets the outcome of a mutant from the error of its build and
+// tests. A daemon error is returned since it tells nothing about the mutant.
+func (r *MutantResult) classify(err error) error {
+	var (
+		daemonErr *DaemonError
+		configErr *ConfigError
+	)
+	switch {
+	case errors.As(err, &daemonErr):
+		return err
+	case errors.As(err, &configErr):
+		r.Invalid = true
+		r.Reason = err.Error()
+	case err != nil:
+		r.Killed = true
+		r.Reason = err.Error()
+	}
+
+	return nil
+}
+
+// status returns the outcome of a mutant as printed by Run.
+func (r *MutantResult) status() string {
+	switch {
+	case r.Killed:
+		return "KILLED  "
+	case r.Invalid:
+		return "INVALID "
+	}
+
+	return "SURVIVED"
+}
+
+func (m *Mutation) printSummary() {
+	fmt.Fprintf(m.out, "----\n%s\n", summarizeMutants(m.results))
+}
+
+// summarizeMutants returns the number of mutants of every outcome and the
+// mutation score, the percentage of the valid mutants that were killed.
+func summarizeMutants(results []MutantResult) string {
+	killed, invalid := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Killed:
+			killed++
+		case result.Invalid:
+			invalid++
+		}
+	}
+
+	valid := len(results) - invalid
+	score := 100.0
+	if valid > 0 {
+		score = 100 * float64(killed) / float64(valid)
+	}
+
+	summary := fmt.Sprintf("%d mutants: %d killed, %d survived", len(results), killed, valid-killed)
+	if invalid > 0 {
+		summary += fmt.Sprintf(", %d invalid", invalid)
+	}
+
+	return summary + fmt.Sprintf(" (mutation score %.1f%%)", score)
+}
+
+// asMutant removes the reporters set by the previous options, and the
+// options that would make the tests of a mutant rewrite the golden files,
+// fail for another reason than the mutation, wait for a debug shell or keep
+// the failures.
+func asMutant() Option {
+	return func(b *Builder) error {
+		b.reporters = nil
+		b.updateSnapshots = false
+		b.minCoverage = 0
+		b.debugOnFailure = false
+		b.keepOnFailure = false
+		b.noTestCache = true
+		return nil
+	}
+}
+
+// generateMutants returns the mutants of a Dockerfile: every RUN and COPY
+// instruction dropped, every package of an apt-get install dropped and every
+// USER instruction switched to another user.
+func generateMutants(dockerfile []byte) ([]*Mutant, error) {
+	cmds, err := parser.Parse(bytes.NewReader(dockerfile))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(dockerfile), "\n")
+
+	var mutants []*Mutant
+	for i, cmd := range cmds {
+		next := len(lines)
+		if i+1 < len(cmds) {
+			next = cmds[i+1].Line - 1
+		}
+		start, end := cmd.Line-1, instructionEnd(lines, cmd, next)
+
+		mutant := func(operator, description, replacement string) *Mutant {
+			text := strings.Join(lines[:start], "") + replacement + strings.Join(lines[end:], "")
+			return &Mutant{Line: cmd.Line, Operator: operator, Description: description, Dockerfile: []byte(text)}
+		}
+		instruction := shortInstruction(cmd)
+
+		switch strings.ToUpper(cmd.Args[0]) {
+		case commands.Run:
+			mutants = append(mutants, mutant(mutateDropRun, "drop "+instruction, ""))
+
+			source := strings.Join(lines[start:end], "")
+			for _, pkg := range aptGetPackages(source) {
+				replacement := source[:pkg[0]] + source[pkg[1]:]
+				mutants = append(mutants, mutant(mutateDropPackage, fmt.Sprintf("drop package %s from apt-get install", source[pkg[0]:pkg[1]]), replacement))
+			}
+		case commands.Copy:
+			mutants = append(mutants, mutant(mutateDropCopy, "drop "+instruction, ""))
+		case commands.User:
+			if len(cmd.Args) < 2 {
+				continue
+			}
+			user := "root"
+			if name := strings.SplitN(cmd.Args[1], ":", 2)[0]; name == "root" || name == "0" {
+				user = "nobody"
+			}
+			mutants = append(mutants, mutant(mutateChangeUser, fmt.Sprintf("change USER %s to %s", cmd.Args[1], user), commands.User+" "+user+"\n"))
+		}
+	}
+
+	return mutants, nil
+}
+
+// instructionEnd returns the index of the line following an instruction
+// starting at cmd.Line, continued by backslashes or a heredoc, and ending
+// before the line next.
+func instructionEnd(lines []string, cmd *parser.Command, next int) int {
+	if cmd.Heredoc != "" {
+		return next
+	}
+
+	end := cmd.Line
+	for end < next && strings.HasSuffix(strings.TrimRight(lines[end-1], " \t\r\n"), `\`) {
+		end++
+	}
+
+	return end
+}
+
+// shortInstruction returns an instruction on a single line, truncated to be
+// printed along with the mutants.
+func shortInstruction(cmd *parser.Command) string {
+	instruction := strings.Join(strings.Fields(instructionString(cmd)), " ")
+	if len(instruction) > 60 {
+		instruction = instruction[:57] + "..."
+	}
+
+	return instruction
+}
+
+// aptGetPackages returns the positions of the packages installed by the
+// apt-get install commands of a shell command.
+func aptGetPackages(source string) [][2]int {
+	var packages [][2]int
+
+	for _, match := range aptGetInstall.FindAllStringIndex(source, -1) {
+		for _, word := range commandWord.FindAllStringIndex(source[match[1]:], -1) {
+			start, end := match[1]+word[0], match[1]+word[1]
+			text := source[start:end]
+
+			if text == "&&" || text == "||" || text == ";" || text == "|" || strings.ContainsAny(text, "<>") {
+				break
+			}
+			last := strings.HasSuffix(text, ";")
+			if last {
+				end--
+				text = text[:len(text)-1]
+			}
+
+			if text != `\` && text != "" && !strings.HasPrefix(text, "-") && !strings.Contains(text, "$") {
+				packages = append(packages, [2]int{start, end})
+			}
+			if last {
+				break
+			}
+		}
+	}
+
+	return packages
+}
@@ -0,0 +1,102 @@
+package build
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateMutants(t *testing.T) {
+	dockerfile := "FROM ubuntu:14.04\n" +
+		"# Install nginx\n" +
+		"RUN apt-get update && \\\n" +
+		"    apt-get install -y --no-install-recommends nginx curl && \\\n" +
+		"    rm -rf /var/lib/apt/lists/*\n" +
+		"\n" +
+		"COPY nginx.conf /etc/nginx/nginx.conf\n" +
+		"USER www-data\n" +
+		"CMD [\"nginx\"]\n"
+
+	mutants, err := generateMutants([]byte(dockerfile))
+	if err != nil {
+		t.Fatalf("unable to generate mutants: %s", err)
+	}
+
+	expected := []struct {
+		line       int
+		operator   string
+		dockerfile string
+	}{
+		{3, mutateDropRun, "FROM ubuntu:14.04\n# Install nginx\n\nCOPY nginx.conf /etc/nginx/nginx.conf\nUSER www-data\nCMD [\"nginx\"]\n"},
+		{3, mutateDropPackage, strings.Replace(dockerfile, " nginx curl", "  curl", 1)},
+		{3, mutateDropPackage, strings.Replace(dockerfile, "nginx curl &&", "nginx  &&", 1)},
+		{7, mutateDropCopy, strings.Replace(dockerfile, "COPY nginx.conf /etc/nginx/nginx.conf\n", "", 1)},
+		{8, mutateChangeUser, strings.Replace(dockerfile, "USER www-data", "USER root", 1)},
+	}
+	if len(mutants) != len(expected) {
+		t.Fatalf("Expected %d mutants, found %d", len(expected), len(mutants))
+	}
+	for i, mutant := range mutants {
+		if mutant.Line != expected[i].line || mutant.Operator != expected[i].operator || string(mutant.Dockerfile) != expected[i].dockerfile {
+			t.Errorf("Unexpected mutant %d (%s at line %d, %s):\n%s", i, mutant.Operator, mutant.Line, mutant.Description, mutant.Dockerfile)
+		}
+	}
+}
+
+func TestAptGetPackages(t *testing.T) {
+	tests := map[string][]string{
+		"apt-get install -y vim git":                 {"vim", "git"},
+		"apt-get -q install vim; apt-get clean":      {"vim"},
+		"apt install -y $PACKAGES jq=1.5 | tee log":  {"jq=1.5"},
+		"apt-get update && apt-get upgrade -y":       nil,
+		"apk add curl && apt-get install curl > log": {"curl"},
+	}
+	for source, expected := range tests {
+		var packages []string
+		for _, pkg := range aptGetPackages(source) {
+			packages = append(packages, source[pkg[0]:pkg[1]])
+		}
+		if strings.Join(packages, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected packages %q in %q, found %q", expected, source, packages)
+		}
+	}
+}
+
+func TestChangeRootUser(t *testing.T) {
+	mutants, err := generateMutants([]byte("FROM alpine\nUSER 0:0\n"))
+	if err != nil {
+		t.Fatalf("unable to generate mutants: %s", err)
+	}
+	if len(mutants) != 1 {
+		t.Fatalf("Expected 1 mutant, found %d", len(mutants))
+	}
+	if dockerfile := string(mutants[0].Dockerfile); dockerfile != "FROM alpine\nUSER nobody\n" {
+		t.Errorf("Expected USER 0:0 to be changed to nobody, found %q", dockerfile)
+	}
+}
+
+func TestClassifyMutant(t *testing.T) {
+	var killed, invalid, survived MutantResult
+	if err := killed.classify(&AssertionFailedError{Err: errors.New("expected nginx to be installed")}); err != nil || !killed.Killed || killed.Invalid {
+		t.Errorf("Expected a failed assertion to kill the mutant, found %+v, %v", killed, err)
+	}
+	if err := invalid.classify(configErrorf("Some tests blocks could not be matched with Dockerfile instructions")); err != nil || invalid.Killed || !invalid.Invalid {
+		t.Errorf("Expected an unmatched test block to make the mutant invalid, found %+v, %v", invalid, err)
+	}
+	if err := survived.classify(nil); err != nil || survived.Killed || survived.Invalid {
+		t.Errorf("Expected the mutant to survive, found %+v, %v", survived, err)
+	}
+
+	var result MutantResult
+	if err := result.classify(daemonErrorf("unable to create container")); err == nil {
+		t.Errorf("Expected a daemon error to be returned")
+	}
+
+	summary := summarizeMutants([]MutantResult{killed, invalid, survived})
+	if summary != "3 mutants: 1 killed, 1 survived, 1 invalid (mutation score 50.0%)" {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+	if summary := summarizeMutants([]MutantResult{invalid}); summary != "1 mutants: 0 killed, 0 survived, 1 invalid (mutation score 100.0%)" {
+		t.Errorf("Unexpected summary without valid mutants: %s", summary)
+	}
+}
@@ -0,0 +1,264 @@
+package build
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/util"
+)
+
+// Option configures a Builder created with NewBuilder.
+type Option func(b *Builder) error
+
+// WithDaemon sets the address of the docker daemon and the TLS configuration
+// used to connect to it. By default the builder connects to DOCKER_HOST or to
+// the local docker socket.
+func WithDaemon(daemonURL string, tlsConfig *tls.Config) Option {
+	return func(b *Builder) error {
+		b.daemonURL = daemonURL
+		b.tlsConfig = tlsConfig
+		b.client2 = nil
+		return nil
+	}
+}
+
+// WithClient makes the builder use an already constructed client. The builder
+// connects to the endpoint of this client with its TLS configuration.
+func WithClient(client *dockerclient2.Client) Option {
+	return func(b *Builder) error {
+		if client == nil {
+			return fmt.Errorf("client must not be nil")
+		}
+		b.daemonURL = client.Endpoint()
+		b.tlsConfig = client.TLSConfig
+		b.client2 = client
+		return nil
+	}
+}
+
+// WithDockerfile sets the path of the Dockerfile to build. It defaults to the
+// Dockerfile of the context directory.
+func WithDockerfile(dockerfilePath string) Option {
+	return func(b *Builder) error {
+		b.dockerfilePath = dockerfilePath
+		return nil
+	}
+}
+
+// WithRepoTag sets the repository name, and optionally the tag, of the image.
+func WithRepoTag(repoTag string) Option {
+	return func(b *Builder) error {
+		repo, tag := util.ParseRepositoryTag(repoTag)
+		if repo != "" {
+			if err := util.ValidateRepositoryName(repo); err != nil {
+				return fmt.Errorf("invalid repository name: %s", err)
+			}
+			if tag != "" {
+				if err := util.ValidateTagName(tag); err != nil {
+					return fmt.Errorf("invalid tag: %s", err)
+				}
+			}
+		}
+		b.repo, b.tag = repo, tag
+		return nil
+	}
+}
+
+// WithImage tests an existing image instead of building the Dockerfile. The
+// @AFTER_RUN and @AFTER_RUN_EXIT blocks run against the image while the
+// blocks referring to Dockerfile instructions are not applicable, unless
+// WithHistory is set. The Dockerfile does not need to exist.
+func WithImage(image string) Option {
+	return func(b *Builder) error {
+		if image == "" {
+			return fmt.Errorf("image name is empty")
+		}
+		b.image = image
+		return nil
+	}
+}
+
+// WithHistory sets whether, when testing an existing image, the @BEFORE and
+// @AFTER blocks run against the layers of the image history matching their
+// Dockerfile instruction reference.
+func WithHistory(checkHistory bool) Option {
+	return func(b *Builder) error {
+		b.checkHistory = checkHistory
+		return nil
+	}
+}
+
+// WithUpdateSnapshots sets whether the golden files of the SNAPSHOT_MATCHES
+// assertions are rewritten with the current file tree of the image instead
+// of being compared to it.
+func WithUpdateSnapshots(updateSnapshots bool) Option {
+	return func(b *Builder) error {
+		b.updateSnapshots = updateSnapshots
+		return nil
+	}
+}
+
+// WithMinCoverage makes the tests fail if less than percent of the Dockerfile
+// instructions are exercised by a @BEFORE, @AFTER or @EXPECT_FAILURE block.
+func WithMinCoverage(percent float64) Option {
+	return func(b *Builder) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("minimum coverage must be between 0 and 100 (found %g)", percent)
+		}
+		b.minCoverage = percent
+		return nil
+	}
+}
+
+// WithOutput sets where the build output and the summary of the tests are
+// printed. It defaults to the standard output.
+func WithOutput(out io.Writer) Option {
+	return func(b *Builder) error {
+		b.out = out
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the builder. It defaults to the standard
+// logrus logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(b *Builder) error {
+		b.logger = logger
+		return nil
+	}
+}
+
+// WithTestFile sets the path of the test file. It defaults to the path of the
+// Dockerfile followed by _test, if such a file exists.
+func WithTestFile(testfilePath string) Option {
+	return func(b *Builder) error {
+		if _, err := os.Stat(testfilePath); err != nil {
+			return fmt.Errorf("unable to access test file: %s", err)
+		}
+		b.dockerTestfilePath = testfilePath
+		b.dockerTestfile = nil
+		return nil
+	}
+}
+
+// WithTestFileReader reads the tests from r instead of a file. The name is
+// used to refer to the tests in the output and in the reports.
+func WithTestFileReader(name string, r io.Reader) Option {
+	return func(b *Builder) error {
+		testfile, err := ioutil.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("unable to read test file: %s", err)
+		}
+		b.dockerTestfilePath = name
+		b.dockerTestfile = testfile
+		return nil
+	}
+}
+
+// WithCacheFile sets the path of the build cache file. It defaults to
+// .dockerunitcache in the home directory of the current user.
+func WithCacheFile(cacheFilePath string) Option {
+	return func(b *Builder) error {
+		b.cacheFilePath = cacheFilePath
+		return nil
+	}
+}
+
+// WithTestCache sets whether the outcome of the assertions that passed is
+// kept in the test cache file, next to the build cache file, and reused
+// instead of running them again against the same image and build context
+// files. It defaults to true.
+func WithTestCache(useTestCache bool) Option {
+	return func(b *Builder) error {
+		b.noTestCache = !useTestCache
+		return nil
+	}
+}
+
+// WithVerbose sets whether the output of the assertions that pass is printed.
+// The output of the assertions that fail is always printed.
+func WithVerbose(verbose bool) Option {
+	return func(b *Builder) error {
+		b.verbose = verbose
+		return nil
+	}
+}
+
+// WithDebugOnFailure sets whether an interactive shell is opened in a
+// container from the image an assertion failed against. The build goes on if
+// the shell exits with code 0 and is aborted otherwise.
+func WithDebugOnFailure(debugOnFailure bool) Option {
+	return func(b *Builder) error {
+		b.debugOnFailure = debugOnFailure
+		return nil
+	}
+}
+
+// WithKeepOnFailure sets whether the container an assertion failed in is
+// committed to the image cunit-failure/<block>:<run-id> to be inspected.
+func WithKeepOnFailure(keepOnFailure bool) Option {
+	return func(b *Builder) error {
+		b.keepOnFailure = keepOnFailure
+		return nil
+	}
+}
+
+// WithReporters adds reporters notified of the events of the build and of the
+// test results, besides the one printing a summary of the tests to the output.
+func WithReporters(reporters ...Reporter) Option {
+	return func(b *Builder) error {
+		b.reporters = append(b.reporters, reporters...)
+		return nil
+	}
+}
+
+// defaultDaemonURL returns the address of the docker daemon set in the
+// environment, or the local docker socket.
+func defaultDaemonURL() (string, error) {
+	if daemonURL := os.Getenv("DOCKER_HOST"); daemonURL != "" {
+		return daemonURL, nil
+	}
+
+	return dockerclient2.DefaultDockerHost()
+}
+
+// defaultCacheFilePath returns the path of the build cache file in the home
+// directory of the current user.
+func defaultCacheFilePath() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("unable to get current user: %s", err)
+	}
+
+	return filepath.Join(usr.HomeDir, ".dockerunitcache"), nil
+}
+
+// newClient2 returns a client connected to the same daemon as the one
+// returned by dockerclient.NewDockerClient for the same arguments.
+func newClient2(daemonURL string, tlsConfig *tls.Config) (*dockerclient2.Client, error) {
+	endpoint := daemonURL
+	if tlsConfig != nil && strings.HasPrefix(endpoint, "tcp://") {
+		endpoint = "https://" + strings.TrimPrefix(endpoint, "tcp://")
+	}
+
+	client, err := dockerclient2.NewVersionedClient(endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		client.TLSConfig = tlsConfig
+		client.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+
+	return client, nil
+}
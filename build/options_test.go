@@ -0,0 +1,98 @@
+package build
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+)
+
+func TestNewBuilderOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-unit")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfilePath := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfilePath, []byte("FROM debian\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+
+	var buf bytes.Buffer
+	b, err := NewBuilder(dir,
+		WithDaemon("tcp://127.0.0.1:2376", nil),
+		WithTestFileReader("inline", strings.NewReader("@AFTER_RUN\nASSERT_TRUE USER_EXISTS root\n")),
+		WithCacheFile(filepath.Join(dir, "cache")),
+		WithOutput(&buf),
+	)
+	if err != nil {
+		t.Fatalf("unable to create builder: %s", err)
+	}
+
+	if b.dockerfilePath != dockerfilePath {
+		t.Errorf("Expected the default Dockerfile %s, found %s", dockerfilePath, b.dockerfilePath)
+	}
+	if !strings.Contains(buf.String(), "Found test file: inline") {
+		t.Errorf("Expected the test file to be printed to the output, found %q", buf.String())
+	}
+	if b.client.URL.Host != "127.0.0.1:2376" || b.client2.Endpoint() != "tcp://127.0.0.1:2376" {
+		t.Errorf("Expected both clients to connect to 127.0.0.1:2376, found %s and %s", b.client.URL, b.client2.Endpoint())
+	}
+
+	tests, err := parseTester(bytes.NewReader(b.dockerTestfile))
+	if err != nil {
+		t.Fatalf("unable to parse test file: %s", err)
+	}
+	if len(tests.testBlocks) != 1 {
+		t.Errorf("Expected 1 block, found %d", len(tests.testBlocks))
+	}
+
+	if _, err := NewBuilder(dir, WithRepoTag("INVALID")); err == nil {
+		t.Errorf("Expected an invalid repository name to be rejected")
+	}
+}
+
+func TestNewClient2TLS(t *testing.T) {
+	tlsConfig := &tls.Config{}
+
+	client, err := newClient2("tcp://127.0.0.1:2376", tlsConfig)
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+
+	if client.Endpoint() != "https://127.0.0.1:2376" || client.TLSConfig != tlsConfig {
+		t.Errorf("Expected a TLS client for https://127.0.0.1:2376, found %s", client.Endpoint())
+	}
+}
+
+func TestWithClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-unit")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM debian\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+
+	client, err := dockerclient2.NewClient("http://10.0.0.1:2375")
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+
+	b, err := NewBuilder(dir, WithClient(client), WithCacheFile(filepath.Join(dir, "cache")))
+	if err != nil {
+		t.Fatalf("unable to create builder: %s", err)
+	}
+
+	if b.client2 != client || b.client.URL.Host != "10.0.0.1:2375" {
+		t.Errorf("Expected both clients to connect to 10.0.0.1:2375, found %s", b.client.URL)
+	}
+}
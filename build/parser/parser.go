@@ -2,14 +2,17 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
 )
 
-// Command has arguments and an input literal from a heredoc.
+// Command has arguments and an input literal from a heredoc. Line is the
+// number of the input line where the command starts.
 type Command struct {
 	Args    []string
 	Heredoc string
+	Line    int
 }
 
 // Parse parses the given input as a line-separated list of arguments.
@@ -17,18 +20,39 @@ type Command struct {
 func Parse(input io.Reader) (commands []*Command, err error) {
 	scanner := bufio.NewScanner(input)
 
-	var currentToken token
-	scanner.Split(tokenize(&currentToken))
+	var (
+		currentToken     token
+		currentTokenLine int
+		line             = 1
+	)
+
+	// Keep track of the line where each token starts by counting the
+	// newlines of the input consumed by the tokenizer.
+	split := tokenize(&currentToken)
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		advance, token, err = split(data, atEOF)
+		if token != nil {
+			currentTokenLine = line
+		}
+		line += bytes.Count(data[:advance], []byte{'\n'})
+
+		return advance, token, err
+	})
 
-	var tokens []token
+	var (
+		tokens     []token
+		tokenLines []int
+	)
 	for scanner.Scan() {
 		tokens = append(tokens, currentToken)
+		tokenLines = append(tokenLines, currentTokenLine)
 
 		if numTokens := len(tokens); numTokens > 1 {
 			prevToken := tokens[numTokens-2]
 			if mergedToken := prevToken.Merge(currentToken); mergedToken != nil {
 				tokens[numTokens-2] = mergedToken
 				tokens = tokens[:numTokens-1]
+				tokenLines = tokenLines[:numTokens-1]
 			}
 		}
 	}
@@ -39,7 +63,7 @@ func Parse(input io.Reader) (commands []*Command, err error) {
 
 	beginning := true
 	var currentCommand *Command
-	for _, token := range tokens {
+	for i, token := range tokens {
 		if token.Type() == tokenTypeWhitespace {
 			continue // Ignore whitespace tokens.
 		}
@@ -74,7 +98,7 @@ func Parse(input io.Reader) (commands []*Command, err error) {
 		beginning = false
 		// Append arg to current command.
 		if currentCommand == nil {
-			currentCommand = &Command{}
+			currentCommand = &Command{Line: tokenLines[i]}
 		}
 		currentCommand.Args = append(currentCommand.Args, token.Value())
 	}
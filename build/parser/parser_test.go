@@ -2,6 +2,7 @@ package parser
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 )
@@ -23,4 +24,24 @@ func TestNewTester(t *testing.T) {
 		t.Fatalf("unable to parse input: %s", err)
 		return
 	}
-}
\ No newline at end of file
+}
+
+func TestParseLines(t *testing.T) {
+	input := "# comment\nFROM debian\n\nRUN apt-get update && \\\n    apt-get install -y vim\nRUN cat <<EOF\nhello\nEOF\nCMD bash\n"
+
+	cmds, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unable to parse input: %s", err)
+	}
+
+	expected := []int{2, 4, 6, 9}
+	if len(cmds) != len(expected) {
+		t.Fatalf("Expected %d commands, found %d", len(expected), len(cmds))
+	}
+
+	for i, cmd := range cmds {
+		if cmd.Line != expected[i] {
+			t.Errorf("Expected command %q to start at line %d, found %d", cmd.Args, expected[i], cmd.Line)
+		}
+	}
+}
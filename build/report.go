@@ -0,0 +1,81 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// EventType is the kind of an event sent to reporters.
+type EventType string
+
+// List of event types.
+const (
+	EventStepStarted      EventType = "step_started"
+	EventStepFinished     EventType = "step_finished"
+	EventCacheHit         EventType = "cache_hit"
+	EventAssertionStarted EventType = "assertion_started"
+	EventAssertionPassed  EventType = "assertion_passed"
+	EventAssertionFailed  EventType = "assertion_failed"
+)
+
+// Event is something that happened while building and testing a Dockerfile.
+// Step fields are set for build step and cache hit events and assertion
+// fields are set for assertion events. Cached is set for the assertions whose
+// outcome is reused from the test cache.
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Dockerfile string
+	ImageID    string
+
+	Step    int
+	Command string
+
+	Block     string
+	Assertion string
+	Line      int
+
+	Duration time.Duration
+	Failure  string
+	Stdout   string
+	Stderr   string
+	Cached   bool
+}
+
+// Reporter is notified of the events of the builds and of the results of the
+// tests. A reporter may be shared by several builders running concurrently
+// so its methods must be safe for concurrent use.
+type Reporter interface {
+	// Event is called every time something happens during a build.
+	Event(event *Event)
+	// Finish is called with the test results once a Dockerfile has been
+	// built and tested.
+	Finish(results *TestResults)
+	// Close is called once every Dockerfile has been built and tested.
+	Close() error
+}
+
+// textReporter prints a human readable summary of the tests of a Dockerfile.
+type textReporter struct {
+	out io.Writer
+}
+
+// NewTextReporter returns a reporter printing a human readable summary of
+// the tests of every Dockerfile to out.
+func NewTextReporter(out io.Writer) Reporter {
+	return &textReporter{out: out}
+}
+
+func (r *textReporter) Event(event *Event) {}
+
+func (r *textReporter) Finish(results *TestResults) {
+	fmt.Fprint(r.out, fmt.Sprintln()+
+		fmt.Sprintln("----")+
+		results.Stats().String()+
+		fmt.Sprintln("\n----"))
+}
+
+func (r *textReporter) Close() error {
+	return nil
+}
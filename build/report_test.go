@@ -0,0 +1,96 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFailedTestResults(t *testing.T) *TestResults {
+	tests, err := newTester("testfile")
+	if err != nil {
+		t.Fatalf("Error creating newTester: %s", err)
+	}
+
+	results := &TestResults{DockerfilePath: "dockerfile", TestfilePath: "testfile", Blocks: newBlockResults(tests)}
+	results.Blocks[0].Assertions[0].Status = StatusPassed
+
+	failed := results.Blocks[1].Assertions[0]
+	failed.Status = StatusFailed
+	failed.Failure = "non-zero exit code: 1"
+	failed.Stderr = "test: missing argument\n"
+
+	return results
+}
+
+func TestTAPReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	reporter := NewTAPReporter(&buf)
+	reporter.Finish(newFailedTestResults(t))
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("unable to close reporter: %s", err)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+
+	expected := map[int]string{
+		0: "TAP version 13",
+		1: "# dockerfile",
+		2: "ok 1 - @AFTER RUN_USERADD: ASSERT_TRUE FILE_EXISTS /home/mario/.profile",
+		3: "not ok 2 - @BEFORE COPY_WORDS: ASSERT_FALSE FILE_EXISTS /usr/local/tomcat/webapps/words",
+		4: "  ---",
+		5: `  message: "non-zero exit code: 1"`,
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("Expected line %d to be %q, found %q", i, line, lines[i])
+		}
+	}
+
+	if !strings.Contains(buf.String(), "ok 3 - @AFTER COPY_WORDS: ASSERT_TRUE FILE_EXISTS /usr/local/tomcat/webapps/words # SKIP") {
+		t.Errorf("Expected skipped assertions to be reported with a SKIP directive:\n%s", buf.String())
+	}
+
+	if !strings.HasSuffix(buf.String(), "\n1..8\n") {
+		t.Errorf("Expected the plan to be written last:\n%s", buf.String())
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	reporter := NewJSONReporter(&buf)
+	reporter.Event(&Event{Type: EventStepStarted, Time: time.Now(), Dockerfile: "Dockerfile", Step: 0, Command: "FROM debian"})
+	reporter.Event(&Event{Type: EventAssertionFailed, Time: time.Now(), Dockerfile: "Dockerfile", ImageID: "abc", Block: "@AFTER_RUN", Assertion: "ASSERT_TRUE FILE_EXISTS /foo", Line: 2, Duration: time.Second, Failure: "failed"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, found %d:\n%s", len(lines), buf.String())
+	}
+
+	var step map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &step); err != nil {
+		t.Fatalf("unable to decode event: %s", err)
+	}
+	if step["type"] != "step_started" || step["step"] != float64(0) || step["command"] != "FROM debian" {
+		t.Errorf("Unexpected step event: %s", lines[0])
+	}
+	if _, ok := step["duration"]; ok {
+		t.Errorf("Expected no duration in a step started event: %s", lines[0])
+	}
+
+	var assertion map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &assertion); err != nil {
+		t.Fatalf("unable to decode event: %s", err)
+	}
+	if assertion["type"] != "assertion_failed" || assertion["image_id"] != "abc" || assertion["duration"] != float64(1) || assertion["line"] != float64(2) {
+		t.Errorf("Unexpected assertion event: %s", lines[1])
+	}
+	if _, ok := assertion["step"]; ok {
+		t.Errorf("Expected no step in an assertion event: %s", lines[1])
+	}
+}
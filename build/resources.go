@@ -0,0 +1,135 @@
+package build
+
+import (
+	"fmt"
+	"time"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	units "github.com/fsouza/go-dockerclient/external/github.com/docker/go-units"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// List of the conditions about the resources used by the container of an
+// @AFTER_RUN block, checked with the stats and inspect APIs of the daemon.
+const (
+	memoryBelow  = "MEMORY_BELOW"
+	notOOMKilled = "NOT_OOM_KILLED"
+	notRestarted = "NOT_RESTARTED"
+)
+
+// isResourceAssertion returns whether an assertion is about the resources
+// used by the container of an @AFTER_RUN block.
+func isResourceAssertion(command *parser.Command) bool {
+	if len(command.Args) < 2 {
+		return false
+	}
+
+	switch command.Args[1] {
+	case memoryBelow, notOOMKilled, notRestarted:
+		return true
+	}
+
+	return false
+}
+
+// parseResourceAssertion checks the arguments of an assertion about the
+// resources used by a container. For MEMORY_BELOW <size> [AFTER <duration>]
+// it returns the size in bytes and the time to wait after the start of the
+// container before measuring the memory usage.
+func parseResourceAssertion(command *parser.Command) (limit int64, after time.Duration, err error) {
+	if err := checkAssertPrefix(command); err != nil {
+		return 0, 0, err
+	}
+
+	if command.Args[1] != memoryBelow {
+		if len(command.Args) != 2 {
+			return 0, 0, fmt.Errorf("Condition %s accept no argument (found %d)", command.Args[1], len(command.Args)-2)
+		}
+		return 0, 0, nil
+	}
+
+	if len(command.Args) != 3 && (len(command.Args) != 5 || command.Args[3] != "AFTER") {
+		return 0, 0, fmt.Errorf("Condition %s expects a size optionally followed by AFTER and a duration, such as 256MB AFTER 30s", memoryBelow)
+	}
+
+	limit, err = units.RAMInBytes(command.Args[2])
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("Condition %s expects a positive size such as 256MB (found %s)", memoryBelow, command.Args[2])
+	}
+
+	if len(command.Args) == 5 {
+		after, err = time.ParseDuration(command.Args[4])
+		if err != nil || after < 0 {
+			return 0, 0, fmt.Errorf("Condition %s expects a duration such as 30s after AFTER (found %s)", memoryBelow, command.Args[4])
+		}
+	}
+
+	return limit, after, nil
+}
+
+// checkResource checks an assertion about the resources used by the running
+// container of an @AFTER_RUN block.
+func (b *Builder) checkResource(containerID string, command *parser.Command, result *AssertionResult) error {
+	limit, after, err := parseResourceAssertion(command)
+	if err != nil {
+		return err
+	}
+
+	container, err := b.client2.InspectContainer(containerID)
+	if err != nil {
+		return daemonErrorf("unable to inspect container: %s", err)
+	}
+
+	var (
+		holds       bool
+		description string
+	)
+	switch command.Args[1] {
+	case memoryBelow:
+		time.Sleep(time.Until(container.State.StartedAt.Add(after)))
+
+		usage, err := b.memoryUsage(containerID)
+		if err != nil {
+			return err
+		}
+		result.Stdout = fmt.Sprintf("memory usage: %s\n", units.BytesSize(float64(usage)))
+
+		holds = usage < uint64(limit)
+		description = fmt.Sprintf("memory usage %s %s after start to be below %s", units.BytesSize(float64(usage)), after, command.Args[2])
+	case notOOMKilled:
+		holds = !container.State.OOMKilled
+		description = "container not to be killed for running out of memory"
+	case notRestarted:
+		result.Stdout = fmt.Sprintf("status: %s, restarts: %d\n", container.State.StateString(), container.RestartCount)
+
+		holds = container.RestartCount == 0 && container.State.Running && !container.State.Restarting
+		description = fmt.Sprintf("container to be running and never restarted, status: %s, restarts: %d", container.State.StateString(), container.RestartCount)
+	}
+
+	return checkHolds(command.Args[0], holds, description, "no "+description)
+}
+
+// memoryUsage returns the memory used by a container, not counting the page
+// cache, like docker stats.
+func (b *Builder) memoryUsage(containerID string) (uint64, error) {
+	statsC := make(chan *dockerclient2.Stats, 1)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- b.client2.Stats(dockerclient2.StatsOptions{ID: containerID, Stats: statsC, Stream: false})
+	}()
+
+	stats := <-statsC
+	if err := <-errC; err != nil {
+		return 0, daemonErrorf("unable to get container stats: %s", err)
+	}
+	if stats == nil {
+		return 0, daemonErrorf("unable to get container stats: no stats returned")
+	}
+
+	usage, cache := stats.MemoryStats.Usage, stats.MemoryStats.Stats.Cache
+	if cache < usage {
+		usage -= cache
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,60 @@
+package build
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestParseResourceAssertion(t *testing.T) {
+	cases := []struct {
+		args  []string
+		limit int64
+		after time.Duration
+	}{
+		{[]string{"ASSERT_TRUE", "MEMORY_BELOW", "256MB"}, 256 * 1024 * 1024, 0},
+		{[]string{"ASSERT_TRUE", "MEMORY_BELOW", "1g", "AFTER", "30s"}, 1024 * 1024 * 1024, 30 * time.Second},
+		{[]string{"ASSERT_TRUE", "NOT_OOM_KILLED"}, 0, 0},
+		{[]string{"ASSERT_FALSE", "NOT_RESTARTED"}, 0, 0},
+	}
+
+	for _, c := range cases {
+		limit, after, err := parseResourceAssertion(&parser.Command{Args: c.args})
+		if err != nil || limit != c.limit || after != c.after {
+			t.Errorf("parseResourceAssertion(%q) == %d, %s, %v, expected %d, %s", c.args, limit, after, err, c.limit, c.after)
+		}
+	}
+
+	invalid := [][]string{
+		{"ASSERT_TRUE", "MEMORY_BELOW"},
+		{"ASSERT_TRUE", "MEMORY_BELOW", "lots"},
+		{"ASSERT_TRUE", "MEMORY_BELOW", "256MB", "AFTER"},
+		{"ASSERT_TRUE", "MEMORY_BELOW", "256MB", "WITHIN", "30s"},
+		{"ASSERT_TRUE", "MEMORY_BELOW", "256MB", "AFTER", "soon"},
+		{"ASSERT_TRUE", "NOT_OOM_KILLED", "now"},
+	}
+	for _, args := range invalid {
+		if _, _, err := parseResourceAssertion(&parser.Command{Args: args}); err == nil {
+			t.Errorf("Expected an error parsing %q", args)
+		}
+	}
+}
+
+func TestParseResourceAssertionInBlock(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER_RUN --memory 512m\n" +
+		"ASSERT_TRUE MEMORY_BELOW 256MB AFTER 30s\n" +
+		"ASSERT_TRUE NOT_OOM_KILLED\n" +
+		"ASSERT_TRUE NOT_RESTARTED\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+	if block := tests.testBlocks[0]; len(block.Asserts) != 3 || len(block.Ephemerals) != 3 || block.RunOptions.Memory != 512*1024*1024 {
+		t.Errorf("Unexpected block: %+v", block)
+	}
+
+	if _, err := parseTester(strings.NewReader("@AFTER_RUN_EXIT\nASSERT_TRUE NOT_OOM_KILLED\n")); err == nil {
+		t.Errorf("Expected an error for a resource assertion outside of an @AFTER_RUN block")
+	}
+}
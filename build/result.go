@@ -0,0 +1,143 @@
+package build
+
+import (
+	"strings"
+	"time"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// Status is the outcome of an assertion.
+type Status string
+
+// List of assertion outcomes. An assertion is skipped when the build or a
+// previous assertion failed before it could run.
+const (
+	StatusPassed  Status = "PASS"
+	StatusFailed  Status = "FAIL"
+	StatusSkipped Status = "SKIP"
+)
+
+// AssertionResult is the outcome of a single assertion of a test file.
+// ImageID is the image the assertion ran against and SkipReason explains why
+// an assertion that could not apply was skipped. Cached is set when the
+// outcome of an assertion that passed in the previous run is reused.
+type AssertionResult struct {
+	Assertion  string
+	Line       int
+	Status     Status
+	Failure    string
+	SkipReason string
+	Stdout     string
+	Stderr     string
+	ImageID    string
+	Duration   time.Duration
+	Cached     bool
+}
+
+// StepResult is the outcome of a Dockerfile instruction. ImageID is the image
+// at the end of the step and CacheHit is set when it came from the build
+// cache.
+type StepResult struct {
+	Step     int
+	Command  string
+	ImageID  string
+	CacheHit bool
+	Failure  string
+	Duration time.Duration
+}
+
+// BlockResult is the outcome of the assertions of a test block.
+type BlockResult struct {
+	Position      string
+	DockerfileRef string
+	Line          int
+	Assertions    []*AssertionResult
+}
+
+// Name returns the test block header as written in the test file.
+func (r *BlockResult) Name() string {
+	if r.DockerfileRef == "" {
+		return r.Position
+	}
+
+	return r.Position + " " + r.DockerfileRef
+}
+
+// TestResults is the outcome of the build steps and of the test blocks of a
+// Dockerfile. ImageID and ImageName are only set if the build succeeded and
+// Coverage only if the Dockerfile is built with a test file.
+type TestResults struct {
+	DockerfilePath string
+	TestfilePath   string
+	ImageID        string
+	ImageName      string
+	Duration       time.Duration
+	Steps          []*StepResult
+	Blocks         []*BlockResult
+	Coverage       *Coverage
+}
+
+// Failed returns whether a build step or an assertion failed.
+func (r *TestResults) Failed() bool {
+	for _, step := range r.Steps {
+		if step.Failure != "" {
+			return true
+		}
+	}
+
+	return r.Stats().NumberOfTestFailed > 0
+}
+
+// newBlockResults returns the results of every assertion of tests, all of
+// them initially skipped.
+func newBlockResults(tests *DockerfileTests) []*BlockResult {
+	var blocks []*BlockResult
+
+	for _, testBlock := range tests.testBlocks {
+		blockResult := &BlockResult{
+			Position:      testBlock.Position,
+			DockerfileRef: testBlock.DockerfileRef,
+			Line:          testBlock.Line,
+		}
+
+		for _, assert := range testBlock.Asserts {
+			blockResult.Assertions = append(blockResult.Assertions, &AssertionResult{
+				Assertion: assertionString(&assert),
+				Line:      assert.Line,
+				Status:    StatusSkipped,
+			})
+		}
+
+		blocks = append(blocks, blockResult)
+	}
+
+	return blocks
+}
+
+// assertionString returns the assertion as written in the test file.
+func assertionString(assert *parser.Command) string {
+	return strings.Join(assert.Args, " ")
+}
+
+// Stats returns the number of assertions that ran, passed and failed.
+func (r *TestResults) Stats() TestStats {
+	var stats TestStats
+
+	for _, block := range r.Blocks {
+		for _, assertion := range block.Assertions {
+			stats.TotalNumberOfTests++
+
+			switch assertion.Status {
+			case StatusPassed:
+				stats.NumberOfTestRan++
+				stats.NumberOfTestPassed++
+			case StatusFailed:
+				stats.NumberOfTestRan++
+				stats.NumberOfTestFailed++
+			}
+		}
+	}
+
+	return stats
+}
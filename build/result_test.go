@@ -0,0 +1,39 @@
+package build
+
+import "testing"
+
+func TestTestResultsStats(t *testing.T) {
+	tests, err := newTester("testfile")
+	if err != nil {
+		t.Fatalf("Error creating newTester: %s", err)
+	}
+
+	results := &TestResults{Blocks: newBlockResults(tests)}
+	if results.Failed() {
+		t.Errorf("Expected results with only skipped assertions not to fail")
+	}
+
+	results.Blocks[0].Assertions[0].Status = StatusPassed
+	results.Blocks[1].Assertions[0].Status = StatusPassed
+	results.Blocks[2].Assertions[0].Status = StatusFailed
+
+	expected := TestStats{
+		TotalNumberOfTests: 8,
+		NumberOfTestRan:    3,
+		NumberOfTestPassed: 2,
+		NumberOfTestFailed: 1,
+	}
+	if stats := results.Stats(); stats != expected {
+		t.Errorf("Expected %+v, found %+v", expected, stats)
+	}
+
+	if !results.Failed() {
+		t.Errorf("Expected results with a failed assertion to fail")
+	}
+
+	results.Blocks[2].Assertions[0].Status = StatusPassed
+	results.Steps = []*StepResult{{Step: 0, Command: "FROM debian"}, {Step: 1, Command: "RUN false", Failure: "non-zero exit code: 1"}}
+	if !results.Failed() {
+		t.Errorf("Expected results with a failed step to fail")
+	}
+}
@@ -0,0 +1,241 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// testCacheSuffix is appended to the path of the build cache file to get the
+// path of the test cache file, where the outcome of the assertions that
+// passed is kept.
+const testCacheSuffix = ".tests"
+
+// resultKey identifies the outcome of an assertion from what it depends on:
+// the image and the configuration it runs against, the block it belongs to,
+// the assertion itself and the files of the build context it reads.
+func resultKey(parts ...interface{}) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		encoded, err := json.Marshal(part)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%#v", part))
+		}
+		hash.Write(encoded)
+		hash.Write([]byte{0})
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// includedFiles returns the files of the build context a build time assertion
+// reads besides the image, and whether its outcome can be reused at all. The
+// assertions of a build step always run, and so do the snapshots while they
+// are being updated.
+func (b *Builder) includedFiles(cmd string, args []string) ([]string, bool) {
+	switch cmd {
+	case commands.Ephemeral:
+		return nil, true
+	case commands.CheckFile:
+		if isContextFileAssertion(&parser.Command{Args: args}) && len(args) > 2 {
+			return args[2:3], true
+		}
+		return nil, true
+	case commands.Snapshot:
+		if b.updateSnapshots || len(args) < 3 {
+			return nil, false
+		}
+		return args[2:3], true
+	}
+
+	return nil, false
+}
+
+// assertionKey returns the key of the outcome of a build time assertion, or
+// "" if it cannot be reused.
+func (b *Builder) assertionKey(cmd string, args []string, ref assertionRef) string {
+	if b.passedResults == nil {
+		return ""
+	}
+
+	files, ok := b.includedFiles(cmd, args)
+	if !ok {
+		return ""
+	}
+
+	return resultKey(b.imageID, b.config.toDocker(), ref.block.Name(), ref.result.Assertion, args, b.contextDigest(files))
+}
+
+// blockKey returns the key of the outcome of an @AFTER_RUN or
+// @AFTER_RUN_EXIT block, which depends on the images the services started
+// from as well.
+func (b *Builder) blockKey(testblock *TestBlock) string {
+	var files []string
+	if testblock.RunOptions != nil {
+		for _, volume := range testblock.RunOptions.Volumes {
+			if src, _, _, err := parseVolume(volume); err == nil {
+				files = append(files, src)
+			}
+		}
+	}
+
+	var asserts []string
+	for _, assert := range testblock.Asserts {
+		if isContextFileAssertion(&assert) && len(assert.Args) > 2 {
+			files = append(files, assert.Args[2])
+		}
+		asserts = append(asserts, assertionString(&assert))
+	}
+
+	return resultKey(b.imageID, b.config.toDocker(), testblock.Position, testblock.RunOptions, b.dockerfileTests.services, b.serviceImages, asserts, b.contextDigest(files))
+}
+
+// contextDigest returns a digest of the names, modes and contents of files of
+// the build context, and of every file under the directories among them.
+func (b *Builder) contextDigest(paths []string) string {
+	hash := sha256.New()
+
+	for _, p := range paths {
+		err := filepath.Walk(filepath.Join(b.contextDirectory, p), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(b.contextDirectory, path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00%o\x00", rel, info.Mode())
+
+			if info.Mode().IsRegular() {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				if _, err := io.Copy(hash, f); err != nil {
+					return err
+				}
+			}
+			hash.Write([]byte{0})
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(hash, "%s\x00missing\x00", p)
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// reuseResult records the outcome of an assertion that passed with the same
+// key in a previous run instead of running it again.
+func (b *Builder) reuseResult(ref assertionRef, key string) bool {
+	previous, ok := b.passedResults[key]
+	if key == "" || !ok {
+		return false
+	}
+
+	// The assertion may have moved in the test file since.
+	line := ref.result.Line
+	*ref.result = *previous
+	ref.result.Line = line
+	ref.result.Cached = true
+
+	b.currentAssertion = nil
+	b.printAssertion(ref.result)
+	b.emit(&Event{
+		Type:      EventAssertionPassed,
+		Block:     ref.block.Name(),
+		Assertion: ref.result.Assertion,
+		Line:      ref.result.Line,
+		Duration:  ref.result.Duration,
+		Stdout:    ref.result.Stdout,
+		Stderr:    ref.result.Stderr,
+		Cached:    true,
+	})
+
+	return true
+}
+
+// rememberResult keeps the outcome of an assertion that passed to be reused
+// by the next runs.
+func (b *Builder) rememberResult(key string, result *AssertionResult) {
+	if b.passedResults == nil || key == "" || result.Status != StatusPassed {
+		return
+	}
+
+	remembered := *result
+	remembered.Cached = false
+	b.passedResults[key] = &remembered
+	b.testCacheChanged = true
+}
+
+// reuseBlock records the outcome of every assertion of an @AFTER_RUN or
+// @AFTER_RUN_EXIT block if they all passed in a previous run, without
+// starting a container.
+func (b *Builder) reuseBlock(index int, testblock *TestBlock) bool {
+	if b.passedResults == nil {
+		return false
+	}
+	key := b.blockKey(testblock)
+
+	block := b.testResults.Blocks[index]
+	for j := range block.Assertions {
+		if _, ok := b.passedResults[fmt.Sprintf("%s/%d", key, j)]; !ok {
+			return false
+		}
+	}
+
+	fmt.Fprintf(b.out, "\nPost Build Test %d: reusing the results of the unchanged block\n", index)
+	for j, result := range block.Assertions {
+		b.startAssertion(assertionRef{block: block, result: result})
+		b.reuseResult(assertionRef{block: block, result: result}, fmt.Sprintf("%s/%d", key, j))
+	}
+
+	return true
+}
+
+// rememberBlock keeps the outcome of every assertion of an @AFTER_RUN or
+// @AFTER_RUN_EXIT block to be reused by the next runs.
+func (b *Builder) rememberBlock(index int, testblock *TestBlock) {
+	if b.passedResults == nil {
+		return
+	}
+	key := b.blockKey(testblock)
+
+	for j, result := range b.testResults.Blocks[index].Assertions {
+		b.rememberResult(fmt.Sprintf("%s/%d", key, j), result)
+	}
+}
+
+// loadTestCache reads the outcome of the assertions that passed in the
+// previous runs.
+func (b *Builder) loadTestCache() error {
+	b.passedResults = map[string]*AssertionResult{}
+
+	cacheFileMu.Lock()
+	defer cacheFileMu.Unlock()
+
+	return readCacheFile(b.testCacheFilePath, &b.passedResults)
+}
+
+// saveTestCache writes the outcome of the assertions that passed, if new ones
+// did since the test cache was loaded. The outcomes kept only in memory by a
+// watch iteration are not written.
+func (b *Builder) saveTestCache() error {
+	if b.passedResults == nil || !b.testCacheChanged || b.testCacheFilePath == "" {
+		return nil
+	}
+	b.testCacheChanged = false
+
+	return saveCacheFile(b.testCacheFilePath, &b.passedResults)
+}
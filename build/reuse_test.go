@@ -0,0 +1,173 @@
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReuseResult(t *testing.T) {
+	passed := map[string]*AssertionResult{}
+	b := &Builder{out: &bytes.Buffer{}, config: &config{}, imageID: "sha256:1", passedResults: passed}
+
+	args := []string{"dpkg", "-l", "nginx"}
+	block := &BlockResult{Position: "@AFTER", DockerfileRef: "RUN_APT-GET"}
+	ref := assertionRef{block: block, result: &AssertionResult{Assertion: "ASSERT_TRUE IS_INSTALLED 'nginx'", Line: 3, Status: StatusPassed, Stdout: "ii nginx"}}
+	b.rememberResult(b.assertionKey("EPHEMERAL", args, ref), ref.result)
+
+	reused := assertionRef{block: block, result: &AssertionResult{Assertion: ref.result.Assertion, Line: 5, Status: StatusSkipped}}
+	if !b.reuseResult(reused, b.assertionKey("EPHEMERAL", args, reused)) {
+		t.Fatalf("Expected the result of the assertion to be reused")
+	}
+	if reused.result.Status != StatusPassed || !reused.result.Cached || reused.result.Stdout != "ii nginx" || reused.result.Line != 5 {
+		t.Errorf("Unexpected reused result: %+v", reused.result)
+	}
+	if !strings.Contains(b.out.(*bytes.Buffer).String(), "(cached pass)") {
+		t.Errorf("Expected the reused result to be printed as a cached pass")
+	}
+
+	b.imageID = "sha256:2"
+	if b.reuseResult(reused, b.assertionKey("EPHEMERAL", args, reused)) {
+		t.Errorf("Expected no result to reuse against another image")
+	}
+
+	b.imageID = "sha256:1"
+	b.config.Env = []string{"APP_ENV=production"}
+	if b.reuseResult(reused, b.assertionKey("EPHEMERAL", args, reused)) {
+		t.Errorf("Expected no result to reuse with another configuration")
+	}
+
+	failed := &AssertionResult{Assertion: "ASSERT_TRUE IS_INSTALLED 'vim'", Status: StatusFailed}
+	b.rememberResult("failed", failed)
+	if _, ok := passed["failed"]; ok {
+		t.Errorf("Expected the failed result not to be kept")
+	}
+
+	b.passedResults = nil
+	if b.assertionKey("EPHEMERAL", args, ref) != "" {
+		t.Errorf("Expected no key without a test cache")
+	}
+}
+
+func TestIncludedFiles(t *testing.T) {
+	b := &Builder{}
+
+	if files, ok := b.includedFiles("EPHEMERAL", []string{"test", "-f", "/etc/app.ini"}); !ok || len(files) != 0 {
+		t.Errorf("Expected EPHEMERAL assertions to be reusable without files, found %v %v", files, ok)
+	}
+	if files, ok := b.includedFiles("CHECK_FILE", []string{"ASSERT_TRUE", "JSON_PATH_EQUALS", "/app.json", ".port", "80"}); !ok || len(files) != 0 {
+		t.Errorf("Expected config file assertions to be reusable without files, found %v %v", files, ok)
+	}
+	if files, ok := b.includedFiles("CHECK_FILE", []string{"ASSERT_TRUE", "FILE_MATCHES_CONTEXT", "app.ini", "/etc/app.ini"}); !ok || strings.Join(files, " ") != "app.ini" {
+		t.Errorf("Expected FILE_MATCHES_CONTEXT assertions to include the context file, found %v %v", files, ok)
+	}
+	if files, ok := b.includedFiles("SNAPSHOT", []string{"ASSERT_TRUE", "SNAPSHOT_MATCHES", "golden/etc.txt", "/etc"}); !ok || strings.Join(files, " ") != "golden/etc.txt" {
+		t.Errorf("Expected snapshot assertions to include the golden file, found %v %v", files, ok)
+	}
+	if _, ok := b.includedFiles("CHECK_STEP", nil); ok {
+		t.Errorf("Expected step assertions not to be reusable")
+	}
+
+	b.updateSnapshots = true
+	if _, ok := b.includedFiles("SNAPSHOT", []string{"ASSERT_TRUE", "SNAPSHOT_MATCHES", "golden/etc.txt"}); ok {
+		t.Errorf("Expected snapshot assertions not to be reusable while updating the snapshots")
+	}
+}
+
+func TestContextDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reuse")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "conf"), 0755); err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf", "app.ini"), []byte("a=1\n"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	b := &Builder{contextDirectory: dir}
+	paths := []string{"conf", "missing"}
+	before := b.contextDigest(paths)
+	if b.contextDigest(paths) != before {
+		t.Errorf("Expected the same digest without changes")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf", "app.ini"), []byte("a=2\n"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if b.contextDigest(paths) == before {
+		t.Errorf("Expected a different digest once the content of a file changed")
+	}
+
+	before = b.contextDigest(paths)
+	if err := ioutil.WriteFile(filepath.Join(dir, "missing"), nil, 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if b.contextDigest(paths) == before {
+		t.Errorf("Expected a different digest once a missing file is created")
+	}
+}
+
+func TestBlockKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reuse")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Builder{contextDirectory: dir, config: &config{}, dockerfileTests: &DockerfileTests{}}
+	if b.blockKey(&TestBlock{Position: "@AFTER_RUN"}) == b.blockKey(&TestBlock{Position: "@AFTER_RUN", RunOptions: &RunOptions{User: "www-data"}}) {
+		t.Errorf("Expected blocks with different run options to have different keys")
+	}
+
+	services := &TestBlock{Position: "@AFTER_RUN"}
+	b.dockerfileTests.services = []Service{{Name: "db", Image: "postgres:latest"}}
+	b.serviceImages = map[string]string{"db": "sha256:1"}
+	before := b.blockKey(services)
+	b.serviceImages["db"] = "sha256:2"
+	if b.blockKey(services) == before {
+		t.Errorf("Expected a different key once the image of a service changed")
+	}
+
+	volume := &TestBlock{Position: "@AFTER_RUN", RunOptions: &RunOptions{Volumes: []string{"conf:/etc/app"}}}
+	before = b.blockKey(volume)
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf"), []byte("a=1\n"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if b.blockKey(volume) == before {
+		t.Errorf("Expected a different key once the mounted build context files changed")
+	}
+}
+
+func TestTestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reuse")
+	if err != nil {
+		t.Fatalf("unable to create cache directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &Builder{testCacheFilePath: filepath.Join(dir, ".dockerunitcache"+testCacheSuffix)}
+	if err := b.loadTestCache(); err != nil {
+		t.Fatalf("Unexpected error loading a missing test cache: %s", err)
+	}
+
+	b.rememberResult("key", &AssertionResult{Assertion: "ASSERT_TRUE USER_EXISTS 'www-data'", Status: StatusPassed, Cached: true})
+	if err := b.saveTestCache(); err != nil {
+		t.Fatalf("Unexpected error saving the test cache: %s", err)
+	}
+
+	other := &Builder{testCacheFilePath: b.testCacheFilePath}
+	if err := other.loadTestCache(); err != nil {
+		t.Fatalf("Unexpected error loading the test cache: %s", err)
+	}
+	result, ok := other.passedResults["key"]
+	if !ok || result.Assertion != "ASSERT_TRUE USER_EXISTS 'www-data'" || result.Cached {
+		t.Errorf("Unexpected result loaded from the test cache: %+v", result)
+	}
+}
@@ -1,18 +1,18 @@
 package build
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/url"
 	"strings"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/l0rd/docker-unit/build/commands"
 )
 
 func (b *Builder) handleRun(args []string, heredoc string) error {
-	log.Debugf("handling %s with args: %#v", commands.Run, args)
+	b.logger.Debugf("handling %s with args: %#v", commands.Run, args)
 
 	if len(args) < 1 {
 		return fmt.Errorf("%s requires at least one argument", commands.Run)
@@ -23,47 +23,99 @@ func (b *Builder) handleRun(args []string, heredoc string) error {
 		b.uncommittedCommands = append(b.uncommittedCommands, fmt.Sprintf("RUN input: %q", heredoc))
 	}
 
-	// If it's EPHEMERAL uncommitted is == false
-    // and we don't need to probecache (instruction should always be executed)
-    if b.uncommitted == true && b.probeCache() {
+	if b.probeCache() {
 		return nil
 	}
 
-	containerID, err := b.createContainer(args[:1], args[1:], true)
+	out := b.out
+	if b.checkedStep != nil {
+		out = io.MultiWriter(b.out, &b.checkedStep.output)
+	}
+
+	return b.runContainer(args, heredoc, out, out)
+}
+
+// handleEphemeral runs the command of an assertion in a temporary container
+// that is never committed. The output of the command is captured in the
+// result of the assertion rather than printed with the build output.
+func (b *Builder) handleEphemeral(args []string, heredoc string) error {
+	b.logger.Debugf("handling %s with args: %#v", commands.Ephemeral, args)
+
+	if len(args) < 1 {
+		return fmt.Errorf("%s requires at least one argument", commands.Ephemeral)
+	}
+
+	if b.currentAssertion == nil {
+		return b.runContainer(args, heredoc, b.out, b.out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := b.runContainer(args, heredoc, &stdout, &stderr)
+
+	b.currentAssertion.result.Stdout = stdout.String()
+	b.currentAssertion.result.Stderr = stderr.String()
+
+	return err
+}
+
+// runContainer runs a command in a new container created from the current
+// image, copying its output streams to stdout and stderr. The container is
+// left for the caller to commit or remove, even if the command failed.
+func (b *Builder) runContainer(args []string, heredoc string, stdout, stderr io.Writer) error {
+	containerID, err := b.runImage(b.imageID, args, heredoc, stdout, stderr)
+
+	b.containerID = containerID
+
+	return err
+}
+
+// runImage runs a command in a new container created from the given image,
+// copying its output streams to stdout and stderr, and returns the ID of the
+// container. The ID is returned along with the error if the command failed
+// once the container was created.
+func (b *Builder) runImage(imageID string, args []string, heredoc string, stdout, stderr io.Writer) (string, error) {
+	config := b.config.toDocker()
+	config.Entrypoint = args[:1]
+	config.Cmd = args[1:]
+	config.Image = imageID
+	config.OpenStdin = true
+	config.StdinOnce = true
+
+	// The container of a build step is committed, the one of an assertion
+	// is not.
+	containerID, err := b.createTrackedContainer(config, b.uncommitted)
 	if err != nil {
-		return fmt.Errorf("unable to create container: %s", err)
+		return "", daemonErrorf("unable to create container: %s", err)
 	}
 
-	errC, err := b.attachContainer(containerID, strings.NewReader(heredoc))
+	errC, err := b.attachContainer(containerID, strings.NewReader(heredoc), stdout, stderr)
 	if err != nil {
-		return fmt.Errorf("unable to attach to container: %s", err)
+		return containerID, daemonErrorf("unable to attach to container: %s", err)
 	}
 
 	if err := b.client.StartContainer(containerID, nil); err != nil {
-		return fmt.Errorf("unable to start container: %s", err)
+		return containerID, daemonErrorf("unable to start container: %s", err)
 	}
 
 	// Wait for the container hijack to end.
 	if err := <-errC; err != nil {
-		return fmt.Errorf("unable to end hijack stream: %s", err)
+		return containerID, daemonErrorf("unable to end hijack stream: %s", err)
 	}
 
 	if err := b.client.StopContainer(containerID, 1); err != nil {
-		return fmt.Errorf("unable to stop/kill container: %s", err)
+		return containerID, daemonErrorf("unable to stop/kill container: %s", err)
 	}
 
 	info, err := b.client.InspectContainer(containerID)
 	if err != nil {
-		return fmt.Errorf("unable to inspect container: %s", err)
+		return containerID, daemonErrorf("unable to inspect container: %s", err)
 	}
 
 	if info.State.ExitCode != 0 {
-		return fmt.Errorf("non-zero exit code: %d", info.State.ExitCode)
+		return containerID, fmt.Errorf("non-zero exit code: %d", info.State.ExitCode)
 	}
 
-	b.containerID = containerID
-
-	return nil
+	return containerID, nil
 }
 
 func (b *Builder) createContainer(entryPoint, cmd []string, openStdin bool) (containerID string, err error) {
@@ -74,10 +126,10 @@ func (b *Builder) createContainer(entryPoint, cmd []string, openStdin bool) (con
 	config.OpenStdin = openStdin
 	config.StdinOnce = openStdin
 
-	return b.client.CreateContainer(config, "")
+	return b.createTrackedContainer(config, true)
 }
 
-func (b *Builder) attachContainer(container string, input io.Reader) (chan error, error) {
+func (b *Builder) attachContainer(container string, input io.Reader, stdout, stderr io.Writer) (chan error, error) {
 	query := make(url.Values, 4)
 	query.Set("stream", "true")
 	query.Set("stdin", "true")
@@ -91,15 +143,24 @@ func (b *Builder) attachContainer(container string, input io.Reader) (chan error
 
 	// The output from /attach will be a multiplexed stream of stdout and
 	// stderr. We need to use a pipe to copy this output into a stdcopy
-	// de-multiplexer and into the build output.
+	// de-multiplexer and into the given output streams.
 	pipeReader, pipeWriter := io.Pipe()
+	copyDone := make(chan struct{})
 	go func() {
+		defer close(copyDone)
 		defer pipeReader.Close()
-		stdcopy.StdCopy(b.out, b.out, pipeReader)
+		stdcopy.StdCopy(stdout, stderr, pipeReader)
 	}()
 
 	go func() {
-		hijackErr <- b.hijack("POST", urlPath, input, pipeWriter, hijackStarted)
+		err := b.hijack("POST", urlPath, input, pipeWriter, hijackStarted)
+
+		// Wait for the de-multiplexer to copy the whole output before
+		// reporting the end of the stream.
+		pipeWriter.Close()
+		<-copyDone
+
+		hijackErr <- err
 	}()
 
 	// Wait for the hijack to succeeed or fail.
@@ -0,0 +1,225 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// List of the conditions about the outcome of the container of an
+// @AFTER_RUN_EXIT block.
+const (
+	exitCodeIs     = "EXIT_CODE_IS"
+	stdoutContains = "STDOUT_CONTAINS"
+	stderrContains = "STDERR_CONTAINS"
+)
+
+// exitConditions is the set of conditions about the outcome of the container
+// of an @AFTER_RUN_EXIT block.
+var exitConditions = map[string]struct{}{
+	exitCodeIs:     {},
+	stdoutContains: {},
+	stderrContains: {},
+}
+
+// isExitAssertion returns whether an assertion is about the outcome of the
+// container of an @AFTER_RUN_EXIT block rather than about its filesystem.
+func isExitAssertion(command *parser.Command) bool {
+	if len(command.Args) < 2 {
+		return false
+	}
+
+	_, ok := exitConditions[command.Args[1]]
+
+	return ok
+}
+
+// validateExitAssertion checks the arguments of an assertion about the
+// outcome of the container of an @AFTER_RUN_EXIT block.
+func validateExitAssertion(command *parser.Command) error {
+	if err := checkAssertPrefix(command); err != nil {
+		return err
+	}
+
+	if len(command.Args) != 3 {
+		return fmt.Errorf("Condition %s accept one and only one argument (found %d)", command.Args[1], len(command.Args)-2)
+	}
+
+	if command.Args[1] == exitCodeIs {
+		if _, err := strconv.Atoi(command.Args[2]); err != nil {
+			return fmt.Errorf("Condition %s expects an integer (found %s)", exitCodeIs, command.Args[2])
+		}
+	}
+
+	return nil
+}
+
+// containerOutcome is how the container of an @AFTER_RUN_EXIT block exited.
+type containerOutcome struct {
+	exitCode int
+	stdout   string
+	stderr   string
+}
+
+// check returns an error if the assertion does not hold for the outcome.
+func (o *containerOutcome) check(command *parser.Command) error {
+	condition, arg := command.Args[1], command.Args[2]
+
+	var (
+		holds       bool
+		description string
+	)
+	switch condition {
+	case exitCodeIs:
+		expected, _ := strconv.Atoi(arg)
+		holds = o.exitCode == expected
+		description = fmt.Sprintf("exit code %d is %s", o.exitCode, arg)
+	case stdoutContains:
+		holds = strings.Contains(o.stdout, arg)
+		description = fmt.Sprintf("stdout contains %q", arg)
+	case stderrContains:
+		holds = strings.Contains(o.stderr, arg)
+		description = fmt.Sprintf("stderr contains %q", arg)
+	}
+
+	return checkHolds(command.Args[0], holds, description, "not "+description)
+}
+
+// runExitTestBlock runs a container from the built image with the options
+// of an @AFTER_RUN_EXIT block until it exits. The assertions about the exit
+// code and the output are checked against the outcome of the container and
+// the other assertions are run in containers created from the filesystem the
+// container left behind.
+func (b *Builder) runExitTestBlock(index int, testblock TestBlock) (err error) {
+	config, err := b.postBuildConfig(testblock)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b.out, "\nPost Build Test %d: running container to completion (entrypoint: %s, cmd: %s)\n", index, config.Entrypoint, config.Cmd)
+
+	containerID, err := b.createTrackedContainer(config, false)
+	if err != nil {
+		return daemonErrorf("unable to create container: %s", err)
+	}
+	keep := false
+	defer func() {
+		if keep {
+			return
+		}
+		if removeErr := b.removeContainer(containerID); removeErr != nil && err == nil {
+			err = daemonErrorf("unable to remove container: %s", removeErr)
+		}
+	}()
+
+	if err := b.connectServiceNetwork(containerID); err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	errC, err := b.attachContainer(containerID, strings.NewReader(""), &stdout, &stderr)
+	if err != nil {
+		return daemonErrorf("unable to attach to container: %s", err)
+	}
+
+	if err := b.client.StartContainer(containerID, nil); err != nil {
+		return daemonErrorf("unable to start container: %s", err)
+	}
+
+	// Wait for the container hijack to end.
+	if err := <-errC; err != nil {
+		return daemonErrorf("unable to end hijack stream: %s", err)
+	}
+
+	exitCode, err := b.client2.WaitContainer(containerID)
+	if err != nil {
+		return daemonErrorf("unable to wait for container: %s", err)
+	}
+
+	outcome := &containerOutcome{exitCode: exitCode, stdout: stdout.String(), stderr: stderr.String()}
+
+	fmt.Fprintf(b.out, "Post Build Test %d: container exited with code %d\n", index, exitCode)
+
+	// The filesystem left behind is committed to an image only if an
+	// assertion needs it.
+	var leftBehind string
+	defer func() {
+		if leftBehind == "" {
+			return
+		}
+		if removeErr := b.client2.RemoveImage(leftBehind); removeErr != nil && err == nil {
+			err = daemonErrorf("unable to remove image: %s", removeErr)
+		}
+	}()
+
+	for j, assert := range testblock.Asserts {
+		ref := assertionRef{
+			block:  b.testResults.Blocks[index],
+			result: b.testResults.Blocks[index].Assertions[j],
+		}
+		start := time.Now()
+
+		b.startAssertion(ref)
+
+		var err error
+		if isExitAssertion(&assert) {
+			ref.result.Stdout, ref.result.Stderr = outcome.stdout, outcome.stderr
+			err = outcome.check(&assert)
+		} else if isFileAssertion(&assert) {
+			err = b.checkFile(containerID, &assert, ref.result)
+		} else {
+			if leftBehind == "" {
+				image, commitErr := b.client2.CommitContainer(dockerclient2.CommitContainerOptions{Container: containerID})
+				if commitErr != nil {
+					err = daemonErrorf("unable to commit container: %s", commitErr)
+				} else {
+					leftBehind = image.ID
+				}
+			}
+			if err == nil {
+				err = b.runLeftBehindTest(leftBehind, testblock.Ephemerals[j].Args[1:], ref.result)
+			}
+		}
+
+		b.finishAssertion(ref, start, err)
+
+		if err != nil {
+			err = stepError(-1, ref.result.Assertion, &ref, err)
+			b.keepFailure(&ref, containerID, b.imageID, err)
+			if !b.debugging(err) {
+				return err
+			}
+
+			// The exited container is kept to be debugged.
+			keep = true
+			if err := b.debugFailure(&ref, debugCommand(&testblock.Ephemerals[j], &ref), b.imageID, containerID, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// runLeftBehindTest runs the command of an assertion in a container created
+// from the image of the filesystem left behind by an @AFTER_RUN_EXIT
+// container.
+func (b *Builder) runLeftBehindTest(imageID string, args []string, result *AssertionResult) error {
+	var stdout, stderr bytes.Buffer
+	containerID, err := b.runImage(imageID, args, "", &stdout, &stderr)
+
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+
+	if containerID != "" {
+		if removeErr := b.removeContainer(containerID); removeErr != nil && err == nil {
+			err = daemonErrorf("unable to remove container: %s", removeErr)
+		}
+	}
+
+	return err
+}
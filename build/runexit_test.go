@@ -0,0 +1,60 @@
+package build
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestParseAfterRunExit(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER_RUN_EXIT --env FOO=bar -- --version\n" +
+		"ASSERT_TRUE EXIT_CODE_IS 0\n" +
+		"ASSERT_TRUE STDOUT_CONTAINS 'v1.0'\n" +
+		"ASSERT_TRUE FILE_EXISTS '/tmp/report.txt'\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	block := tests.testBlocks[0]
+	if block.RunOptions == nil || block.RunOptions.Cmd[0] != "--version" || block.RunOptions.Env[0] != "FOO=bar" {
+		t.Errorf("Unexpected @AFTER_RUN_EXIT options: %+v", block.RunOptions)
+	}
+	if len(block.Asserts) != 3 || len(block.Ephemerals) != 3 || block.Ephemerals[2].Args[0] != "EPHEMERAL" {
+		t.Errorf("Unexpected @AFTER_RUN_EXIT block: %+v", block)
+	}
+
+	invalid := []string{
+		"@AFTER_RUN_EXIT\nASSERT_TRUE EXIT_CODE_IS zero\n",
+		"@AFTER_RUN_EXIT\nASSERT_TRUE STDOUT_CONTAINS\n",
+		"@AFTER_RUN\nASSERT_TRUE EXIT_CODE_IS 0\n",
+	}
+	for _, testfile := range invalid {
+		if _, err := parseTester(strings.NewReader(testfile)); err == nil {
+			t.Errorf("Expected an error parsing %q", testfile)
+		}
+	}
+}
+
+func TestContainerOutcomeCheck(t *testing.T) {
+	outcome := &containerOutcome{exitCode: 2, stdout: "usage: tool [options]\n", stderr: "missing argument\n"}
+
+	cases := []struct {
+		args  []string
+		holds bool
+	}{
+		{[]string{"ASSERT_TRUE", "EXIT_CODE_IS", "2"}, true},
+		{[]string{"ASSERT_TRUE", "EXIT_CODE_IS", "0"}, false},
+		{[]string{"ASSERT_FALSE", "EXIT_CODE_IS", "0"}, true},
+		{[]string{"ASSERT_TRUE", "STDOUT_CONTAINS", "usage:"}, true},
+		{[]string{"ASSERT_TRUE", "STDERR_CONTAINS", "usage:"}, false},
+		{[]string{"ASSERT_FALSE", "STDERR_CONTAINS", "panic"}, true},
+	}
+
+	for _, c := range cases {
+		err := outcome.check(&parser.Command{Args: c.args})
+		if (err == nil) != c.holds {
+			t.Errorf("check(%q) == %v, expected the assertion to hold: %v", c.args, err, c.holds)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	units "github.com/fsouza/go-dockerclient/external/github.com/docker/go-units"
+	"github.com/samalba/dockerclient"
+)
+
+// RunOptions are the options of the container started for an @AFTER_RUN or
+// @AFTER_RUN_EXIT test block, given in the header of the block:
+//
+//	@AFTER_RUN --env KEY=value --publish 8080:80 --cmd 'nginx -g "daemon off;"' --user www-data --volume conf:/etc/nginx/conf.d:ro
+//	@AFTER_RUN --memory 256m --cpus 0.5
+//	@AFTER_RUN_EXIT --env KEY=value -- --version
+type RunOptions struct {
+	Env     []string
+	Publish []string
+	Cmd     []string
+	User    string
+	Volumes []string
+	// Memory is the memory limit of the container in bytes, 0 for no limit.
+	Memory int64
+	// CPUs is the number of CPUs the container can use, 0 for no limit.
+	CPUs float64
+}
+
+// cpuPeriod is the CFS scheduling period, in microseconds, of the containers
+// limited with --cpus.
+const cpuPeriod = 100000
+
+// parseRunOptions parses the arguments of an @AFTER_RUN or @AFTER_RUN_EXIT
+// header. Every option is followed by its value, either as the next argument
+// or after an equal sign. The arguments following -- replace the command of
+// the image, like the arguments of docker run.
+func parseRunOptions(args []string) (*RunOptions, error) {
+	options := &RunOptions{}
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			options.Cmd = append([]string{}, args[i+1:]...)
+			break
+		}
+
+		name, value := args[i], ""
+		if eq := strings.Index(name, "="); eq > 0 {
+			name, value = name[:eq], name[eq+1:]
+		} else if i+1 < len(args) {
+			i++
+			value = args[i]
+		} else {
+			return nil, fmt.Errorf("option %s requires a value", name)
+		}
+
+		switch name {
+		case "--env":
+			if !strings.Contains(value, "=") {
+				return nil, fmt.Errorf("invalid --env %q: expected KEY=value", value)
+			}
+			options.Env = append(options.Env, value)
+		case "--publish":
+			if _, _, err := parsePortBinding(value); err != nil {
+				return nil, err
+			}
+			options.Publish = append(options.Publish, value)
+		case "--cmd":
+			cmd, err := parseRunCmd(value)
+			if err != nil {
+				return nil, err
+			}
+			options.Cmd = cmd
+		case "--user":
+			options.User = value
+		case "--volume":
+			if _, _, _, err := parseVolume(value); err != nil {
+				return nil, err
+			}
+			options.Volumes = append(options.Volumes, value)
+		case "--memory":
+			memory, err := units.RAMInBytes(value)
+			if err != nil || memory <= 0 {
+				return nil, fmt.Errorf("invalid --memory %q: expected a size such as 256m", value)
+			}
+			options.Memory = memory
+		case "--cpus":
+			cpus, err := strconv.ParseFloat(value, 64)
+			if err != nil || cpus <= 0 {
+				return nil, fmt.Errorf("invalid --cpus %q: expected a positive number such as 0.5", value)
+			}
+			options.CPUs = cpus
+		default:
+			return nil, fmt.Errorf("unknown option %s: only --env, --publish, --cmd, --user, --volume, --memory and --cpus are supported", name)
+		}
+	}
+
+	return options, nil
+}
+
+// parseRunCmd parses the value of --cmd, either a JSON array or a string run
+// with /bin/sh -c like the shell form of CMD.
+func parseRunCmd(value string) ([]string, error) {
+	if strings.HasPrefix(value, "[") {
+		var cmd []string
+		if err := json.Unmarshal([]byte(value), &cmd); err != nil {
+			return nil, fmt.Errorf("invalid --cmd %q: %s", value, err)
+		}
+		return cmd, nil
+	}
+
+	return []string{"/bin/sh", "-c", value}, nil
+}
+
+// parsePortBinding parses the value of --publish: [[ip:]hostPort:]containerPort[/protocol].
+func parsePortBinding(value string) (port string, binding dockerclient.PortBinding, err error) {
+	proto := "tcp"
+	if slash := strings.LastIndex(value, "/"); slash >= 0 {
+		value, proto = value[:slash], value[slash+1:]
+	}
+
+	parts := strings.Split(value, ":")
+	switch len(parts) {
+	case 1:
+		port = parts[0]
+	case 2:
+		binding.HostPort, port = parts[0], parts[1]
+	case 3:
+		binding.HostIp, binding.HostPort, port = parts[0], parts[1], parts[2]
+		if net.ParseIP(binding.HostIp) == nil {
+			return "", binding, fmt.Errorf("invalid --publish %q: invalid IP address %s", value, binding.HostIp)
+		}
+	default:
+		return "", binding, fmt.Errorf("invalid --publish %q", value)
+	}
+
+	if port == "" || (proto != "tcp" && proto != "udp") {
+		return "", binding, fmt.Errorf("invalid --publish %q", value)
+	}
+
+	return port + "/" + proto, binding, nil
+}
+
+// parseVolume parses the value of --volume: source:destination[:ro|rw], where
+// source is a path relative to the build context directory.
+func parseVolume(value string) (src, dst, mode string, err error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", "", "", fmt.Errorf("invalid --volume %q: expected source:destination[:ro|rw]", value)
+	}
+
+	src, dst = filepath.Clean(parts[0]), parts[1]
+	if len(parts) == 3 {
+		mode = parts[2]
+		if mode != "ro" && mode != "rw" {
+			return "", "", "", fmt.Errorf("invalid --volume %q: mode must be ro or rw", value)
+		}
+	}
+
+	if filepath.IsAbs(src) || src == ".." || strings.HasPrefix(src, ".."+string(filepath.Separator)) {
+		return "", "", "", fmt.Errorf("invalid --volume %q: source must be inside the build context directory", value)
+	}
+	if !strings.HasPrefix(dst, "/") {
+		return "", "", "", fmt.Errorf("invalid --volume %q: destination must be an absolute path", value)
+	}
+
+	return src, dst, mode, nil
+}
+
+// containerConfig returns the configuration of a container running the image
+// with the given options. The sources of the volumes are resolved against the
+// context directory.
+func (o *RunOptions) containerConfig(base *dockerclient.ContainerConfig, contextDirectory string) (*dockerclient.ContainerConfig, error) {
+	config := *base
+	config.Env = append(append([]string{}, base.Env...), o.Env...)
+	if o.User != "" {
+		config.User = o.User
+	}
+	if o.Cmd != nil {
+		config.Cmd = o.Cmd
+	}
+
+	if o.Memory > 0 {
+		config.HostConfig.Memory = o.Memory
+	}
+	if o.CPUs > 0 {
+		// Like docker run --cpus, the limit is a quota of CPU time per
+		// scheduling period.
+		config.HostConfig.CpuPeriod = cpuPeriod
+		config.HostConfig.CpuQuota = int64(o.CPUs * cpuPeriod)
+	}
+
+	config.ExposedPorts = map[string]struct{}{}
+	for port := range base.ExposedPorts {
+		config.ExposedPorts[port] = struct{}{}
+	}
+	config.HostConfig.PortBindings = map[string][]dockerclient.PortBinding{}
+	for _, publish := range o.Publish {
+		port, binding, err := parsePortBinding(publish)
+		if err != nil {
+			return nil, err
+		}
+		config.ExposedPorts[port] = struct{}{}
+		config.HostConfig.PortBindings[port] = append(config.HostConfig.PortBindings[port], binding)
+	}
+
+	contextDirectory, err := filepath.Abs(contextDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get absolute path of context directory: %s", err)
+	}
+	for _, volume := range o.Volumes {
+		src, dst, mode, err := parseVolume(volume)
+		if err != nil {
+			return nil, err
+		}
+		bind := filepath.Join(contextDirectory, src) + ":" + dst
+		if mode != "" {
+			bind += ":" + mode
+		}
+		config.HostConfig.Binds = append(config.HostConfig.Binds, bind)
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,95 @@
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samalba/dockerclient"
+)
+
+func TestParseRunOptions(t *testing.T) {
+	options, err := parseRunOptions([]string{
+		"--env", "FOO=bar",
+		"--env=BAZ=qux",
+		"--publish", "127.0.0.1:8080:80",
+		"--publish", "53/udp",
+		"--cmd", `nginx -g "daemon off;"`,
+		"--user", "www-data",
+		"--volume", "conf:/etc/nginx/conf.d:ro",
+		"--memory", "256m",
+		"--cpus=1.5",
+	})
+	if err != nil {
+		t.Fatalf("unable to parse run options: %s", err)
+	}
+
+	expected := &RunOptions{
+		Env:     []string{"FOO=bar", "BAZ=qux"},
+		Publish: []string{"127.0.0.1:8080:80", "53/udp"},
+		Cmd:     []string{"/bin/sh", "-c", `nginx -g "daemon off;"`},
+		User:    "www-data",
+		Volumes: []string{"conf:/etc/nginx/conf.d:ro"},
+		Memory:  256 * 1024 * 1024,
+		CPUs:    1.5,
+	}
+	if !reflect.DeepEqual(options, expected) {
+		t.Errorf("Expected %+v, found %+v", expected, options)
+	}
+
+	invalid := [][]string{
+		{"--env"},
+		{"--env", "FOO"},
+		{"--publish", "a:b:80"},
+		{"--volume", "../secrets:/secrets"},
+		{"--volume", "/etc:/etc"},
+		{"--cmd", "[nginx"},
+		{"--network", "host"},
+		{"--memory", "lots"},
+		{"--cpus", "0"},
+	}
+	for _, args := range invalid {
+		if _, err := parseRunOptions(args); err == nil {
+			t.Errorf("Expected an error parsing %q", args)
+		}
+	}
+}
+
+func TestRunOptionsContainerConfig(t *testing.T) {
+	options := &RunOptions{
+		Env:     []string{"FOO=bar"},
+		Publish: []string{"8080:80"},
+		Cmd:     []string{"nginx"},
+		Volumes: []string{"conf:/etc/nginx/conf.d:ro"},
+		Memory:  64 * 1024 * 1024,
+		CPUs:    0.5,
+	}
+
+	base := &dockerclient.ContainerConfig{
+		Env:          []string{"PATH=/bin"},
+		Cmd:          []string{"sh"},
+		User:         "root",
+		ExposedPorts: map[string]struct{}{"443/tcp": {}},
+	}
+
+	config, err := options.containerConfig(base, "/context")
+	if err != nil {
+		t.Fatalf("unable to get container config: %s", err)
+	}
+
+	if !reflect.DeepEqual(config.Env, []string{"PATH=/bin", "FOO=bar"}) || config.User != "root" || config.Cmd[0] != "nginx" {
+		t.Errorf("Unexpected container config: %+v", config)
+	}
+	if _, ok := config.ExposedPorts["80/tcp"]; !ok || len(base.ExposedPorts) != 1 {
+		t.Errorf("Expected port 80/tcp to be exposed without changing the image config, found %v", config.ExposedPorts)
+	}
+	if bindings := config.HostConfig.PortBindings["80/tcp"]; len(bindings) != 1 || bindings[0].HostPort != "8080" {
+		t.Errorf("Expected port 80/tcp to be published on 8080, found %v", config.HostConfig.PortBindings)
+	}
+	if config.HostConfig.Memory != 64*1024*1024 || config.HostConfig.CpuPeriod != 100000 || config.HostConfig.CpuQuota != 50000 {
+		t.Errorf("Unexpected resource limits: %+v", config.HostConfig)
+	}
+	if len(config.HostConfig.Binds) != 1 || !strings.HasSuffix(config.HostConfig.Binds[0], "/context/conf:/etc/nginx/conf.d:ro") {
+		t.Errorf("Unexpected binds: %v", config.HostConfig.Binds)
+	}
+}
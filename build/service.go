@@ -0,0 +1,155 @@
+package build
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/samalba/dockerclient"
+)
+
+// Service is a container declared in a test file with @SERVICE and started
+// along with the containers of the @AFTER_RUN and @AFTER_RUN_EXIT blocks:
+//
+//	@SERVICE db postgres:9.5 POSTGRES_PASSWORD=secret
+type Service struct {
+	Name  string
+	Image string
+	Env   []string
+	Line  int
+}
+
+var validServiceName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// parseService parses the arguments of a @SERVICE declaration.
+func parseService(args []string, line int) (Service, error) {
+	if len(args) < 2 {
+		return Service{}, fmt.Errorf("%s at line %d requires a name and an image", commands.Service, line)
+	}
+
+	service := Service{Name: args[0], Image: args[1], Line: line}
+	if !validServiceName.MatchString(service.Name) {
+		return Service{}, fmt.Errorf("invalid %s name at line %d: %s", commands.Service, line, service.Name)
+	}
+
+	for _, env := range args[2:] {
+		if !strings.Contains(env, "=") {
+			return Service{}, fmt.Errorf("invalid %s environment variable at line %d: expected KEY=value, found %s", commands.Service, line, env)
+		}
+		service.Env = append(service.Env, env)
+	}
+
+	return service, nil
+}
+
+// startServices creates a private network and starts the services of the test
+// file in it, each of them being resolvable by its name. The returned function
+// stops and removes the services and the network, and must be called even if
+// an error is returned.
+func (b *Builder) startServices(services []Service) (teardown func() error, err error) {
+	var containerIDs []string
+	teardown = func() error {
+		var teardownErr error
+		for _, containerID := range containerIDs {
+			if err := b.removeContainer(containerID); err != nil && teardownErr == nil {
+				teardownErr = daemonErrorf("unable to remove service container: %s", err)
+			}
+		}
+		if b.serviceNetwork != "" {
+			if err := b.client2.RemoveNetwork(b.serviceNetwork); err != nil && teardownErr == nil {
+				teardownErr = daemonErrorf("unable to remove service network: %s", err)
+			}
+			b.serviceNetwork = ""
+		}
+		return teardownErr
+	}
+
+	b.serviceImages = map[string]string{}
+	if len(services) == 0 {
+		return teardown, nil
+	}
+
+	network, err := b.client2.CreateNetwork(dockerclient2.CreateNetworkOptions{
+		Name:           "cunit-" + b.runID,
+		CheckDuplicate: true,
+	})
+	if err != nil {
+		return teardown, daemonErrorf("unable to create service network: %s", err)
+	}
+	b.serviceNetwork = network.ID
+
+	for _, service := range services {
+		image := normalizeImageName(service.Image)
+
+		fmt.Fprintf(b.out, "\nStarting service %s (%s)\n", service.Name, image)
+
+		imageID, err := b.ensureImage(image)
+		if err != nil {
+			return teardown, err
+		}
+		b.serviceImages[service.Name] = imageID
+
+		containerID, err := b.createTrackedContainer(&dockerclient.ContainerConfig{Image: image, Env: service.Env}, false)
+		if err != nil {
+			return teardown, daemonErrorf("unable to create service container: %s", err)
+		}
+		containerIDs = append(containerIDs, containerID)
+
+		if err := b.connectServiceNetwork(containerID, service.Name); err != nil {
+			return teardown, err
+		}
+
+		if err := b.client.StartContainer(containerID, nil); err != nil {
+			return teardown, daemonErrorf("unable to start service %s: %s", service.Name, err)
+		}
+	}
+
+	return teardown, nil
+}
+
+// connectServiceNetwork connects a container to the network of the services,
+// if any, where it can be resolved by the given aliases.
+func (b *Builder) connectServiceNetwork(containerID string, aliases ...string) error {
+	if b.serviceNetwork == "" {
+		return nil
+	}
+
+	err := b.client2.ConnectNetwork(b.serviceNetwork, dockerclient2.NetworkConnectionOptions{
+		Container:      containerID,
+		EndpointConfig: &dockerclient2.EndpointConfig{Aliases: aliases},
+	})
+	if err != nil {
+		return daemonErrorf("unable to connect container to service network: %s", err)
+	}
+
+	return nil
+}
+
+// ensureImage pulls an image unless it is already present, and returns its
+// ID.
+func (b *Builder) ensureImage(image string) (string, error) {
+	info, err := b.client.InspectImage(image)
+	if err == nil {
+		return info.Id, nil
+	}
+	if err != dockerclient.ErrNotFound {
+		return "", daemonErrorf("unable to inspect image: %s", err)
+	}
+
+	fmt.Fprintf(b.out, "pulling image %s ...\n", image)
+	if err := b.client.PullImage(image, nil); err != nil {
+		if _, ok := err.(*url.Error); ok {
+			return "", daemonErrorf("unable to pull image %s: %s", image, err)
+		}
+		return "", configErrorf("unable to pull image %s: %s", image, err)
+	}
+
+	if info, err = b.client.InspectImage(image); err != nil {
+		return "", daemonErrorf("unable to inspect image: %s", err)
+	}
+
+	return info.Id, nil
+}
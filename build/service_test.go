@@ -0,0 +1,41 @@
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseServices(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@SERVICE db postgres:9.5 POSTGRES_PASSWORD=secret\n" +
+		"@SERVICE broker rabbitmq\n" +
+		"@AFTER_RUN --env DATABASE_HOST=db\n" +
+		"ASSERT_TRUE PROCESS_EXISTS app\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	expected := []Service{
+		{Name: "db", Image: "postgres:9.5", Env: []string{"POSTGRES_PASSWORD=secret"}, Line: 1},
+		{Name: "broker", Image: "rabbitmq", Line: 2},
+	}
+	if !reflect.DeepEqual(tests.services, expected) {
+		t.Errorf("Expected services %+v, found %+v", expected, tests.services)
+	}
+	if len(tests.testBlocks) != 1 {
+		t.Errorf("Expected 1 block, found %d", len(tests.testBlocks))
+	}
+
+	invalid := []string{
+		"@SERVICE db\n@AFTER_RUN\nASSERT_TRUE PROCESS_EXISTS app\n",
+		"@SERVICE -db postgres\n@AFTER_RUN\nASSERT_TRUE PROCESS_EXISTS app\n",
+		"@SERVICE db postgres PASSWORD\n@AFTER_RUN\nASSERT_TRUE PROCESS_EXISTS app\n",
+		"@SERVICE db postgres\n@SERVICE db mysql\n@AFTER_RUN\nASSERT_TRUE PROCESS_EXISTS app\n",
+		"@SERVICE db postgres\nASSERT_TRUE PROCESS_EXISTS app\n",
+	}
+	for _, testfile := range invalid {
+		if _, err := parseTester(strings.NewReader(testfile)); err == nil {
+			t.Errorf("Expected an error parsing %q", testfile)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package build
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+	"github.com/samalba/dockerclient"
+)
+
+// snapshotMatches is the condition comparing the file tree of the image to a
+// golden file of the build context:
+//
+//	ASSERT_TRUE SNAPSHOT_MATCHES snapshots/app.golden /etc /usr/local/bin
+const snapshotMatches = "SNAPSHOT_MATCHES"
+
+// snapshotExcludes are the files that docker adds to every container and
+// that are left out of the snapshots of the whole file tree.
+var snapshotExcludes = map[string]struct{}{
+	"/.dockerenv":        {},
+	"/etc/hostname":      {},
+	"/etc/hosts":         {},
+	"/etc/resolv.conf":   {},
+	"/run/.containerenv": {},
+}
+
+// isSnapshotAssertion returns whether an assertion compares the file tree of
+// the image to a golden file.
+func isSnapshotAssertion(command *parser.Command) bool {
+	return len(command.Args) > 1 && command.Args[1] == snapshotMatches
+}
+
+// validateSnapshotAssertion checks the arguments of a SNAPSHOT_MATCHES
+// <golden-file> [paths...] assertion.
+func validateSnapshotAssertion(command *parser.Command) error {
+	if command.Args[0] != commands.AssertTrue {
+		return fmt.Errorf("Condition %s can only be used with %s", snapshotMatches, commands.AssertTrue)
+	}
+
+	if len(command.Args) < 3 {
+		return fmt.Errorf("Condition %s requires a golden file", snapshotMatches)
+	}
+
+	if !insideContext(command.Args[2]) {
+		return fmt.Errorf("Condition %s requires a golden file inside the build context directory (found %s)", snapshotMatches, command.Args[2])
+	}
+
+	for _, p := range command.Args[3:] {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("Condition %s requires absolute paths (found %s)", snapshotMatches, p)
+		}
+	}
+
+	return nil
+}
+
+// snapshotCheck returns the command checking a snapshot assertion against
+// the image at the point of the build where it is injected.
+func snapshotCheck(command *parser.Command) parser.Command {
+	return parser.Command{
+		Args: append([]string{commands.Snapshot}, command.Args...),
+		Line: command.Line,
+	}
+}
+
+// handleSnapshot compares the file tree of the current image to a golden
+// file.
+func (b *Builder) handleSnapshot(args []string, heredoc string) error {
+	b.logger.Debugf("handling %s with args: %#v", commands.Snapshot, args)
+
+	if len(args) < 3 {
+		return fmt.Errorf("%s requires a golden file", commands.Snapshot)
+	}
+
+	result := &AssertionResult{}
+	if b.currentAssertion != nil {
+		result = b.currentAssertion.result
+	}
+
+	return b.checkSnapshot(b.imageID, args[2], args[3:], result)
+}
+
+// checkSnapshot compares the manifest of the file tree of an image, or of the
+// given paths only, to a golden file of the build context. The golden file is
+// rewritten instead if the snapshots are being updated.
+func (b *Builder) checkSnapshot(imageID, golden string, paths []string, result *AssertionResult) error {
+	var manifest []string
+	err := b.withImageContainer(imageID, func(containerID string) (err error) {
+		manifest, err = b.snapshotManifest(containerID, paths)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	goldenPath := filepath.Join(b.contextDirectory, golden)
+
+	if b.updateSnapshots {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+			return fmt.Errorf("unable to create golden file directory: %s", err)
+		}
+		if err := ioutil.WriteFile(goldenPath, []byte(strings.Join(manifest, "\n")+"\n"), 0644); err != nil {
+			return fmt.Errorf("unable to write golden file: %s", err)
+		}
+		result.Stdout = fmt.Sprintf("updated %s (%d entries)\n", golden, len(manifest))
+		return nil
+	}
+
+	expected, err := ioutil.ReadFile(goldenPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("golden file %s does not exist, run with --update-snapshots to create it", golden)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read golden file: %s", err)
+	}
+
+	if diff := unifiedDiff(golden, "image", splitLines(string(expected)), manifest); diff != "" {
+		result.Stdout = diff
+		return fmt.Errorf("file tree does not match %s", golden)
+	}
+
+	return nil
+}
+
+// withImageContainer calls fn with a container created, but not started, from
+// an image to read its files through the archive API.
+func (b *Builder) withImageContainer(imageID string, fn func(containerID string) error) (err error) {
+	containerID, err := b.createTrackedContainer(&dockerclient.ContainerConfig{
+		Image:      imageID,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"#(nop)"},
+	}, false)
+	if err != nil {
+		return daemonErrorf("unable to create container: %s", err)
+	}
+	defer func() {
+		if removeErr := b.removeContainer(containerID); removeErr != nil && err == nil {
+			err = daemonErrorf("unable to remove container: %s", removeErr)
+		}
+	}()
+
+	return fn(containerID)
+}
+
+// snapshotManifest returns one line per file of the container, or of the
+// given paths only, sorted by path, with the mode, the owner and either the
+// checksum of the content or the target of the link.
+func (b *Builder) snapshotManifest(containerID string, paths []string) ([]string, error) {
+	entries := map[string]string{}
+
+	if len(paths) == 0 {
+		err := b.readContainerArchive("/", entries, func(w io.Writer) error {
+			return b.client2.ExportContainer(dockerclient2.ExportContainerOptions{ID: containerID, OutputStream: w})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for excluded := range snapshotExcludes {
+			delete(entries, excluded)
+		}
+	}
+
+	for _, p := range paths {
+		err := b.readContainerArchive(path.Dir(path.Clean(p)), entries, func(w io.Writer) error {
+			return b.client2.DownloadFromContainer(containerID, dockerclient2.DownloadFromContainerOptions{Path: p, OutputStream: w})
+		})
+		if err != nil {
+			if e, ok := err.(*DaemonError); ok {
+				if apiErr, ok := e.Err.(*dockerclient2.Error); ok && apiErr.Status == http.StatusNotFound {
+					return nil, fmt.Errorf("path %s does not exist in the image", p)
+				}
+			}
+			return nil, err
+		}
+	}
+
+	manifest := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		manifest = append(manifest, entry)
+	}
+	sort.Strings(manifest)
+
+	return manifest, nil
+}
+
+// readContainerArchive adds the files of the tar archive written by download
+// to the entries of a manifest, their names being relative to dir.
+func (b *Builder) readContainerArchive(dir string, entries map[string]string, download func(w io.Writer) error) error {
+	return b.readContainerArchiveFunc(download, func(archive *tar.Reader) error {
+		return readManifestEntries(archive, dir, entries)
+	})
+}
+
+// readContainerArchiveFunc calls read with the tar archive written by
+// download.
+func (b *Builder) readContainerArchiveFunc(download func(w io.Writer) error, read func(archive *tar.Reader) error) error {
+	pipeReader, pipeWriter := io.Pipe()
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := download(pipeWriter)
+		pipeWriter.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	err := read(tar.NewReader(pipeReader))
+	pipeReader.CloseWithError(err)
+
+	// The archive cannot be read if the download failed, and the download
+	// fails if the archive cannot be read.
+	if dlErr := <-downloadErr; dlErr != nil && (err == nil || err == dlErr) {
+		return &DaemonError{Step: -1, Err: dlErr}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read container archive: %s", err)
+	}
+
+	return nil
+}
+
+// readManifestEntries adds a manifest entry for every file of a tar archive.
+func readManifestEntries(archive *tar.Reader, dir string, entries map[string]string) error {
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Join("/", dir, header.Name)
+		if name == "/" {
+			continue
+		}
+
+		entry := fmt.Sprintf("%s %s %d:%d", name, header.FileInfo().Mode(), header.Uid, header.Gid)
+		switch header.Typeflag {
+		case tar.TypeReg:
+			digest := sha256.New()
+			if _, err := io.Copy(digest, archive); err != nil {
+				return err
+			}
+			entry += fmt.Sprintf(" sha256:%x", digest.Sum(nil))
+		case tar.TypeSymlink:
+			entry += " -> " + header.Linkname
+		case tar.TypeLink:
+			entry += " => " + path.Join("/", dir, header.Linkname)
+		}
+
+		entries[name] = entry
+	}
+}
@@ -0,0 +1,85 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestReadManifestEntries(t *testing.T) {
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	files := []struct {
+		header  tar.Header
+		content string
+	}{
+		{tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "etc/motd", Typeflag: tar.TypeReg, Mode: 0644, Size: 6}, "hello\n"},
+		{tar.Header{Name: "etc/motd.link", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "motd"}, ""},
+		{tar.Header{Name: "etc/motd.hard", Typeflag: tar.TypeLink, Mode: 0644, Uid: 1000, Gid: 1000, Linkname: "etc/motd"}, ""},
+	}
+	for _, file := range files {
+		if err := archive.WriteHeader(&file.header); err != nil {
+			t.Fatalf("unable to write header: %s", err)
+		}
+		archive.Write([]byte(file.content))
+	}
+	archive.Close()
+
+	entries := map[string]string{}
+	if err := readManifestEntries(tar.NewReader(&buf), "/", entries); err != nil {
+		t.Fatalf("unable to read archive: %s", err)
+	}
+
+	expected := map[string]string{
+		"/etc":           "/etc drwxr-xr-x 0:0",
+		"/etc/motd":      "/etc/motd -rw-r--r-- 0:0 sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+		"/etc/motd.link": "/etc/motd.link Lrwxrwxrwx 0:0 -> motd",
+		"/etc/motd.hard": "/etc/motd.hard -rw-r--r-- 1000:1000 => /etc/motd",
+	}
+	for name, entry := range expected {
+		if entries[name] != entry {
+			t.Errorf("Expected entry %q, found %q", entry, entries[name])
+		}
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %d entries, found %d", len(expected), len(entries))
+	}
+}
+
+func TestParseSnapshotAssertion(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER RUN_APT-GET\n" +
+		"ASSERT_TRUE SNAPSHOT_MATCHES snapshots/etc.golden /etc /usr/local/bin\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+	if args := tests.testBlocks[0].Ephemerals[0].Args; strings.Join(args, " ") != "SNAPSHOT ASSERT_TRUE SNAPSHOT_MATCHES snapshots/etc.golden /etc /usr/local/bin" {
+		t.Errorf("Unexpected snapshot check: %q", args)
+	}
+
+	invalid := [][]string{
+		{"ASSERT_FALSE", "SNAPSHOT_MATCHES", "etc.golden"},
+		{"ASSERT_TRUE", "SNAPSHOT_MATCHES"},
+		{"ASSERT_TRUE", "SNAPSHOT_MATCHES", "../etc.golden"},
+		{"ASSERT_TRUE", "SNAPSHOT_MATCHES", "etc.golden", "etc"},
+	}
+	for _, args := range invalid {
+		if err := validateSnapshotAssertion(&parser.Command{Args: args}); err == nil {
+			t.Errorf("Expected an error validating %q", args)
+		}
+	}
+
+	// Snapshots are not injected commands of their own step.
+	cmds := []*parser.Command{
+		{Args: []string{"FROM", "busybox"}},
+		{Args: []string{"RUN", "true"}},
+		{Args: []string{"SNAPSHOT", "ASSERT_TRUE", "SNAPSHOT_MATCHES", "all.golden"}},
+		{Args: []string{"CHECK_STEP", "ASSERT_TRUE", "STEP_DURATION_BELOW", "1m"}},
+	}
+	if checked := findCheckedSteps(cmds); len(checked) != 1 || checked[cmds[1]] {
+		t.Errorf("Expected RUN to be checked, found %v", checked)
+	}
+}
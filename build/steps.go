@@ -0,0 +1,142 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// List of the conditions about the outcome of the Dockerfile instruction
+// matched by an @AFTER or @EXPECT_FAILURE block.
+const (
+	stepOutputContains = "STEP_OUTPUT_CONTAINS"
+	stepDurationBelow  = "STEP_DURATION_BELOW"
+)
+
+// checkedStep is the outcome of a Dockerfile instruction checked by step
+// assertions.
+type checkedStep struct {
+	expectFailure bool
+	output        bytes.Buffer
+	duration      time.Duration
+	err           error
+	// cached is set when the outcome is replayed from the cache.
+	cached bool
+}
+
+// isStepAssertion returns whether an assertion is about the outcome of a
+// Dockerfile instruction rather than about the image.
+func isStepAssertion(command *parser.Command) bool {
+	if len(command.Args) < 2 {
+		return false
+	}
+
+	return command.Args[1] == stepOutputContains || command.Args[1] == stepDurationBelow
+}
+
+// validateStepAssertion checks the arguments of an assertion about the
+// outcome of a Dockerfile instruction.
+func validateStepAssertion(command *parser.Command) error {
+	if err := checkAssertPrefix(command); err != nil {
+		return err
+	}
+
+	if len(command.Args) != 3 {
+		return fmt.Errorf("Condition %s accept one and only one argument (found %d)", command.Args[1], len(command.Args)-2)
+	}
+
+	if command.Args[1] == stepDurationBelow {
+		if d, err := time.ParseDuration(command.Args[2]); err != nil || d <= 0 {
+			return fmt.Errorf("Condition %s expects a positive duration such as 2m (found %s)", stepDurationBelow, command.Args[2])
+		}
+	}
+
+	return nil
+}
+
+// stepCheck returns the command checking a step assertion once the
+// Dockerfile instruction it follows has run.
+func stepCheck(command *parser.Command) parser.Command {
+	return parser.Command{
+		Args: append([]string{commands.CheckStep}, command.Args...),
+		Line: command.Line,
+	}
+}
+
+// findCheckedSteps returns the Dockerfile instructions followed by step
+// checks, and whether they are expected to fail.
+func findCheckedSteps(cmds []*parser.Command) map[*parser.Command]bool {
+	checked := map[*parser.Command]bool{}
+
+	var step *parser.Command
+	for _, command := range cmds {
+		cmd := strings.ToUpper(command.Args[0])
+		if cmd == commands.CheckStep {
+			checked[step] = checked[step] || strings.ToUpper(command.Args[1]) == commands.ExpectFailure
+		} else if _, isAssertion := commands.TestCommands[cmd]; !isAssertion {
+			step = command
+		}
+	}
+
+	return checked
+}
+
+// isStepFailure returns whether a Dockerfile instruction failed by itself
+// rather than because of the daemon or of an invalid configuration.
+func isStepFailure(err error) bool {
+	var (
+		daemonErr *DaemonError
+		configErr *ConfigError
+	)
+
+	return err != nil && !errors.As(err, &daemonErr) && !errors.As(err, &configErr)
+}
+
+// handleCheckStep checks an assertion about the outcome of the last
+// Dockerfile instruction.
+func (b *Builder) handleCheckStep(args []string, heredoc string) error {
+	b.logger.Debugf("handling %s with args: %#v", commands.CheckStep, args)
+
+	step := b.checkedStep
+	if step == nil || len(args) < 2 {
+		return fmt.Errorf("%s must follow a Dockerfile instruction", commands.CheckStep)
+	}
+
+	var result *AssertionResult
+	if b.currentAssertion != nil {
+		result = b.currentAssertion.result
+	} else {
+		result = &AssertionResult{}
+	}
+
+	if strings.ToUpper(args[0]) == commands.ExpectFailure {
+		if step.err == nil {
+			return fmt.Errorf("expected the instruction to fail, it succeeded")
+		}
+		result.Stdout = fmt.Sprintf("failed as expected: %s\n", step.err)
+		return nil
+	}
+
+	var (
+		holds       bool
+		description string
+	)
+	switch args[1] {
+	case stepOutputContains:
+		result.Stdout = step.output.String()
+		holds = strings.Contains(step.output.String(), args[2])
+		description = fmt.Sprintf("instruction output contains %q", args[2])
+	case stepDurationBelow:
+		budget, _ := time.ParseDuration(args[2])
+		result.Stdout = fmt.Sprintf("instruction took %.2fs\n", step.duration.Seconds())
+		holds = step.duration < budget
+		description = fmt.Sprintf("instruction duration %.2fs is below %s", step.duration.Seconds(), budget)
+	}
+
+	return checkHolds(args[0], holds, description, "not "+description)
+}
@@ -0,0 +1,120 @@
+package build
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestParseStepAssertions(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@EXPECT_FAILURE RUN_SHA256SUM\n" +
+		"ASSERT_TRUE STEP_OUTPUT_CONTAINS 'FAILED'\n" +
+		"@AFTER RUN_APT-GET\n" +
+		"ASSERT_FALSE STEP_OUTPUT_CONTAINS 'WARNING'\n" +
+		"ASSERT_TRUE STEP_DURATION_BELOW 2m\n" +
+		"ASSERT_TRUE IS_INSTALLED 'curl'\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	expectFailure := tests.testBlocks[0]
+	if expectFailure.DockerfileRef != "RUN_SHA256SUM" || len(expectFailure.Asserts) != 2 {
+		t.Fatalf("Unexpected @EXPECT_FAILURE block: %+v", expectFailure)
+	}
+	if args := expectFailure.Ephemerals[0].Args; strings.Join(args, " ") != "CHECK_STEP @EXPECT_FAILURE RUN_SHA256SUM" {
+		t.Errorf("Unexpected check of the expected failure: %q", args)
+	}
+
+	after := tests.testBlocks[1]
+	for i, expected := range []string{"CHECK_STEP", "CHECK_STEP", "EPHEMERAL"} {
+		if after.Ephemerals[i].Args[0] != expected {
+			t.Errorf("Expected assertion %d to be run with %s, found %q", i, expected, after.Ephemerals[i].Args)
+		}
+	}
+
+	invalid := []string{
+		"@EXPECT_FAILURE\nASSERT_TRUE STEP_OUTPUT_CONTAINS 'FAILED'\n",
+		"@AFTER RUN_APT-GET\nASSERT_TRUE STEP_DURATION_BELOW soon\n",
+		"@AFTER RUN_APT-GET\nASSERT_TRUE STEP_OUTPUT_CONTAINS\n",
+		"@BEFORE RUN_APT-GET\nASSERT_TRUE STEP_DURATION_BELOW 2m\n",
+		"@AFTER_RUN\nASSERT_TRUE STEP_OUTPUT_CONTAINS 'WARNING'\n",
+	}
+	for _, testfile := range invalid {
+		if _, err := parseTester(strings.NewReader(testfile)); err == nil {
+			t.Errorf("Expected an error parsing %q", testfile)
+		}
+	}
+}
+
+func TestInjectStepChecks(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@EXPECT_FAILURE RUN_FALSE\n" +
+		"@AFTER RUN_TRUE\n" +
+		"ASSERT_TRUE STEP_DURATION_BELOW 1m\n" +
+		"ASSERT_TRUE FILE_EXISTS '/bin/sh'\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	cmds := []*parser.Command{
+		{Args: []string{"FROM", "busybox"}},
+		{Args: []string{"RUN", "false"}},
+		{Args: []string{"RUN", "true"}},
+		{Args: []string{"ENV", "FOO", "bar"}},
+	}
+	injected, err := Inject(cmds, tests)
+	if err != nil {
+		t.Fatalf("unable to inject tests: %s", err)
+	}
+
+	var found []string
+	for _, cmd := range injected {
+		found = append(found, cmd.Args[0])
+	}
+	if expected := "FROM RUN CHECK_STEP RUN CHECK_STEP EPHEMERAL ENV"; strings.Join(found, " ") != expected {
+		t.Errorf("Expected %s, found %s", expected, strings.Join(found, " "))
+	}
+
+	checked := findCheckedSteps(injected)
+	if len(checked) != 2 || !checked[cmds[1]] || checked[cmds[2]] {
+		t.Errorf("Unexpected checked steps: %v", checked)
+	}
+}
+
+func TestHandleCheckStep(t *testing.T) {
+	b := &Builder{logger: log.New(), checkedStep: &checkedStep{duration: 3 * time.Second}}
+	b.checkedStep.output.WriteString("WARNING: deprecated\n")
+
+	cases := []struct {
+		args  []string
+		holds bool
+	}{
+		{[]string{"ASSERT_TRUE", "STEP_OUTPUT_CONTAINS", "WARNING"}, true},
+		{[]string{"ASSERT_FALSE", "STEP_OUTPUT_CONTAINS", "WARNING"}, false},
+		{[]string{"ASSERT_TRUE", "STEP_DURATION_BELOW", "1m"}, true},
+		{[]string{"ASSERT_TRUE", "STEP_DURATION_BELOW", "1s"}, false},
+		{[]string{"@EXPECT_FAILURE", "RUN_FALSE"}, false},
+	}
+	for _, c := range cases {
+		if err := b.handleCheckStep(c.args, ""); (err == nil) != c.holds {
+			t.Errorf("handleCheckStep(%q) == %v, expected the check to hold: %t", c.args, err, c.holds)
+		}
+	}
+
+	b.checkedStep.err = errors.New("non-zero exit code: 1")
+	if err := b.handleCheckStep([]string{"@EXPECT_FAILURE", "RUN_FALSE"}, ""); err != nil {
+		t.Errorf("Expected the failure to be expected, found %s", err)
+	}
+}
+
+func TestIsStepFailure(t *testing.T) {
+	if !isStepFailure(errors.New("non-zero exit code: 1")) {
+		t.Errorf("Expected a failed command to be a step failure")
+	}
+	if isStepFailure(nil) || isStepFailure(daemonErrorf("unable to start container")) || isStepFailure(configErrorf("invalid")) {
+		t.Errorf("Expected daemon and config errors not to be step failures")
+	}
+}
@@ -0,0 +1,129 @@
+package build
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// stopsGracefullyWithin is the condition sending a signal to the container of
+// an @AFTER_RUN block and checking that it exits soon enough.
+const stopsGracefullyWithin = "STOPS_GRACEFULLY_WITHIN"
+
+// stopSignals are the signals that can be sent with STOPS_GRACEFULLY_WITHIN.
+var stopSignals = map[string]dockerclient2.Signal{
+	"SIGHUP":  dockerclient2.SIGHUP,
+	"SIGINT":  dockerclient2.SIGINT,
+	"SIGQUIT": dockerclient2.SIGQUIT,
+	"SIGKILL": dockerclient2.SIGKILL,
+	"SIGUSR1": dockerclient2.SIGUSR1,
+	"SIGUSR2": dockerclient2.SIGUSR2,
+	"SIGTERM": dockerclient2.SIGTERM,
+}
+
+// isStopAssertion returns whether an assertion stops the container of an
+// @AFTER_RUN block.
+func isStopAssertion(command *parser.Command) bool {
+	return len(command.Args) > 1 && command.Args[1] == stopsGracefullyWithin
+}
+
+// parseStopAssertion returns the timeout and the signal of a
+// STOPS_GRACEFULLY_WITHIN <duration> [SIGNAL] assertion. The signal defaults
+// to SIGTERM, like docker stop.
+func parseStopAssertion(command *parser.Command) (time.Duration, dockerclient2.Signal, error) {
+	if err := checkAssertPrefix(command); err != nil {
+		return 0, 0, err
+	}
+
+	if len(command.Args) != 3 && len(command.Args) != 4 {
+		return 0, 0, fmt.Errorf("Condition %s accept a duration and an optional signal (found %d arguments)", stopsGracefullyWithin, len(command.Args)-2)
+	}
+
+	timeout, err := time.ParseDuration(command.Args[2])
+	if err != nil || timeout <= 0 {
+		return 0, 0, fmt.Errorf("Condition %s expects a positive duration such as 5s (found %s)", stopsGracefullyWithin, command.Args[2])
+	}
+
+	signal := dockerclient2.SIGTERM
+	if len(command.Args) == 4 {
+		name := strings.ToUpper(command.Args[3])
+		if number, err := strconv.Atoi(name); err == nil && number > 0 {
+			signal = dockerclient2.Signal(number)
+		} else if s, ok := stopSignals[name]; ok {
+			signal = s
+		} else if s, ok := stopSignals["SIG"+name]; ok {
+			signal = s
+		} else {
+			return 0, 0, fmt.Errorf("Condition %s does not support signal %s", stopsGracefullyWithin, command.Args[3])
+		}
+	}
+
+	return timeout, signal, nil
+}
+
+// stopKillTimeout is how long a container is waited for once it is killed
+// because it did not stop within the timeout of a STOPS_GRACEFULLY_WITHIN
+// assertion.
+const stopKillTimeout = 10 * time.Second
+
+// checkGracefulStop sends the signal of a STOPS_GRACEFULLY_WITHIN assertion
+// to a running container and waits for it to exit. The container stops
+// gracefully if it exits before the timeout with either a zero exit code or
+// the code of a process terminated by the signal. It is killed otherwise.
+func (b *Builder) checkGracefulStop(containerID string, command *parser.Command, result *AssertionResult) error {
+	timeout, signal, err := parseStopAssertion(command)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := b.client2.KillContainer(dockerclient2.KillContainerOptions{ID: containerID, Signal: signal}); err != nil {
+		return daemonErrorf("unable to send signal %d to container: %s", signal, err)
+	}
+
+	type waitResult struct {
+		exitCode int
+		err      error
+	}
+	waitC := make(chan waitResult, 1)
+	go func() {
+		exitCode, err := b.client2.WaitContainer(containerID)
+		waitC <- waitResult{exitCode, err}
+	}()
+
+	var (
+		holds       bool
+		description string
+	)
+	select {
+	case <-time.After(timeout):
+		description = fmt.Sprintf("container to stop within %s after signal %d", timeout, signal)
+
+		// Killing the container lets the wait for it return.
+		killErr := b.client2.KillContainer(dockerclient2.KillContainerOptions{ID: containerID, Signal: dockerclient2.SIGKILL})
+		select {
+		case <-waitC:
+		case <-time.After(stopKillTimeout):
+			if killErr != nil {
+				return daemonErrorf("unable to kill container: %s", killErr)
+			}
+			return daemonErrorf("container did not exit within %s once killed", stopKillTimeout)
+		}
+	case wait := <-waitC:
+		if wait.err != nil {
+			return daemonErrorf("unable to wait for container: %s", wait.err)
+		}
+
+		elapsed := time.Since(start)
+		result.Stdout = fmt.Sprintf("exited with code %d after %.2fs\n", wait.exitCode, elapsed.Seconds())
+
+		holds = wait.exitCode == 0 || wait.exitCode == 128+int(signal)
+		description = fmt.Sprintf("container to exit with code 0 or %d within %s after signal %d, exited with code %d after %.2fs", 128+int(signal), timeout, signal, wait.exitCode, elapsed.Seconds())
+	}
+
+	return checkHolds(command.Args[0], holds, description, "no "+description)
+}
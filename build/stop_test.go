@@ -0,0 +1,110 @@
+package build
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dockerclient2 "github.com/fsouza/go-dockerclient"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+func TestParseStopAssertion(t *testing.T) {
+	cases := []struct {
+		args    []string
+		timeout time.Duration
+		signal  dockerclient2.Signal
+	}{
+		{[]string{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "5s"}, 5 * time.Second, dockerclient2.SIGTERM},
+		{[]string{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "500ms", "SIGINT"}, 500 * time.Millisecond, dockerclient2.SIGINT},
+		{[]string{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "10s", "quit"}, 10 * time.Second, dockerclient2.SIGQUIT},
+		{[]string{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "1m", "10"}, time.Minute, dockerclient2.SIGUSR1},
+	}
+
+	for _, c := range cases {
+		timeout, signal, err := parseStopAssertion(&parser.Command{Args: c.args})
+		if err != nil || timeout != c.timeout || signal != c.signal {
+			t.Errorf("parseStopAssertion(%q) == %s, %d, %v, expected %s, %d", c.args, timeout, signal, err, c.timeout, c.signal)
+		}
+	}
+
+	invalid := [][]string{
+		{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN"},
+		{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "5"},
+		{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "-5s"},
+		{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "5s", "SIGFOO"},
+	}
+	for _, args := range invalid {
+		if _, _, err := parseStopAssertion(&parser.Command{Args: args}); err == nil {
+			t.Errorf("Expected an error parsing %q", args)
+		}
+	}
+}
+
+func TestParseStopAssertionInBlock(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER_RUN\n" +
+		"ASSERT_TRUE NO_ZOMBIE_PROCESSES\n" +
+		"ASSERT_TRUE STOPS_GRACEFULLY_WITHIN 5s\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+	if block := tests.testBlocks[0]; len(block.Asserts) != 2 || len(block.Ephemerals) != 2 {
+		t.Errorf("Unexpected block: %+v", block)
+	}
+
+	invalid := []string{
+		"@AFTER_RUN\nASSERT_TRUE STOPS_GRACEFULLY_WITHIN 5s\nASSERT_TRUE PROCESS_EXISTS nginx\n",
+		"@AFTER_RUN_EXIT\nASSERT_TRUE STOPS_GRACEFULLY_WITHIN 5s\n",
+	}
+	for _, testfile := range invalid {
+		if _, err := parseTester(strings.NewReader(testfile)); err == nil {
+			t.Errorf("Expected an error parsing %q", testfile)
+		}
+	}
+}
+
+func TestCheckGracefulStopTimeout(t *testing.T) {
+	killed := make(chan struct{})
+	waited := make(chan struct{})
+	var signals []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/kill"):
+			signal := r.URL.Query().Get("signal")
+			signals = append(signals, signal)
+			if signal == "9" {
+				close(killed)
+			}
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			// The container ignores the stop signal until it is killed.
+			<-killed
+			json.NewEncoder(w).Encode(map[string]int{"StatusCode": 137})
+			close(waited)
+		}
+	}))
+	defer server.Close()
+
+	client, err := dockerclient2.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+	b := &Builder{client2: client}
+
+	command := &parser.Command{Args: []string{"ASSERT_TRUE", "STOPS_GRACEFULLY_WITHIN", "50ms"}}
+	err = b.checkGracefulStop("c1", command, &AssertionResult{})
+	if err == nil || !strings.Contains(err.Error(), "expected container to stop within 50ms") {
+		t.Errorf("Expected the assertion to fail on timeout, found %v", err)
+	}
+	if strings.Join(signals, ",") != "15,9" {
+		t.Errorf("Expected SIGTERM then SIGKILL to be sent, found %v", signals)
+	}
+
+	select {
+	case <-waited:
+	default:
+		t.Errorf("Expected the wait for the container to return once it is killed")
+	}
+}
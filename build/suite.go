@@ -0,0 +1,221 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// TargetResult is the outcome of building and testing a single target.
+// SkipReason is set when the target was not built because an image it is
+// based on failed.
+type TargetResult struct {
+	Target     Target
+	Stats      TestStats
+	Tests      *TestResults
+	Err        error
+	SkipReason string
+}
+
+// Failed returns whether the build or one of the tests of the target failed.
+func (r *TargetResult) Failed() bool {
+	return r.Err != nil || r.Stats.NumberOfTestFailed > 0
+}
+
+// Skipped returns whether the target was not built at all.
+func (r *TargetResult) Skipped() bool {
+	return r.SkipReason != ""
+}
+
+// Suite builds and tests several targets, running up to a fixed number of
+// builders at the same time. A target whose FROM instruction names the image
+// built by another target of the suite is only built once that target has
+// been built and tested successfully.
+type Suite struct {
+	targets     []Target
+	concurrency int
+	options     []Option
+	results     []TargetResult
+
+	out   io.Writer
+	outMu sync.Mutex
+}
+
+// NewSuite creates a suite for the given targets. A concurrency lower than 1
+// means that targets are processed one at a time. The options are used to
+// create the builder of every target, except that the Dockerfile, the
+// repository and the output are set by the suite.
+func NewSuite(targets []Target, concurrency int, options ...Option) *Suite {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Suite{
+		targets:     targets,
+		concurrency: concurrency,
+		options:     options,
+		out:         os.Stdout,
+	}
+}
+
+// Run builds and tests every target of the suite and prints a summary of the
+// results. An error is returned if any target failed.
+func (s *Suite) Run() error {
+	if len(s.targets) == 0 {
+		return configErrorf("no Dockerfile with a test file found")
+	}
+
+	deps, err := targetDependencies(s.targets)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+
+	results := make([]TargetResult, len(s.targets))
+	done := make([]chan struct{}, len(s.targets))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, s.concurrency)
+
+	var wg sync.WaitGroup
+	for i := range s.targets {
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				close(done[i])
+				wg.Done()
+			}()
+
+			// Wait for the upstream images to be built and tested.
+			for _, j := range deps[i] {
+				<-done[j]
+
+				if results[j].Failed() || results[j].Skipped() {
+					results[i] = s.skipTarget(s.targets[i], s.targets[j])
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = s.runTarget(s.targets[i])
+		}(i)
+	}
+	wg.Wait()
+
+	s.results = results
+
+	return s.printSummary(results)
+}
+
+// Results returns the outcome of every target once the suite has run.
+func (s *Suite) Results() []TargetResult {
+	return s.results
+}
+
+// runTarget builds and tests a single target. The output of the builder is
+// buffered and written as a whole once the target is done so that the output
+// of concurrent builds does not interleave.
+func (s *Suite) runTarget(target Target) (result TargetResult) {
+	result.Target = target
+
+	var buf bytes.Buffer
+	defer func() {
+		s.outMu.Lock()
+		defer s.outMu.Unlock()
+
+		fmt.Fprintf(s.out, "==== %s ====\n", target.DockerfilePath)
+		buf.WriteTo(s.out)
+		if result.Err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", result.Err)
+		}
+		fmt.Fprintln(s.out)
+	}()
+
+	options := append([]Option{}, s.options...)
+	options = append(options,
+		WithDockerfile(target.DockerfilePath),
+		WithRepoTag(target.RepoTag),
+		WithOutput(&buf),
+	)
+
+	b, err := NewBuilder(target.ContextDirectory, options...)
+	if err != nil {
+		result.Err = fmt.Errorf("unable to initialize builder: %w", err)
+		return result
+	}
+
+	result.Tests, result.Err = b.Test()
+	result.Stats = result.Tests.Stats()
+
+	return result
+}
+
+// skipTarget returns the result of a target that is not built because the
+// upstream target building its base image failed or was skipped.
+func (s *Suite) skipTarget(target, upstream Target) TargetResult {
+	result := TargetResult{
+		Target:     target,
+		SkipReason: fmt.Sprintf("upstream image %s (%s) did not pass", upstream.RepoTag, upstream.DockerfilePath),
+	}
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	fmt.Fprintf(s.out, "==== %s ====\nskipped: %s\n\n", target.DockerfilePath, result.SkipReason)
+
+	return result
+}
+
+func (s *Suite) printSummary(results []TargetResult) error {
+	var (
+		total    TestStats
+		failures int
+		skipped  int
+		worst    error
+	)
+
+	fmt.Fprintln(s.out, "----")
+	for _, result := range results {
+		if result.Skipped() {
+			skipped++
+			fmt.Fprintf(s.out, "SKIP %s: %s\n", result.Target.DockerfilePath, result.SkipReason)
+			continue
+		}
+
+		status := "PASS"
+		if result.Failed() {
+			status = "FAIL"
+			failures++
+		}
+		if errorSeverity(result.Err) > errorSeverity(worst) {
+			worst = result.Err
+		}
+
+		fmt.Fprintf(s.out, "%s %s: %s\n", status, result.Target.DockerfilePath, result.Stats.String())
+
+		total.TotalNumberOfTests += result.Stats.TotalNumberOfTests
+		total.NumberOfTestRan += result.Stats.NumberOfTestRan
+		total.NumberOfTestPassed += result.Stats.NumberOfTestPassed
+		total.NumberOfTestFailed += result.Stats.NumberOfTestFailed
+	}
+	fmt.Fprintln(s.out, "----")
+	fmt.Fprintf(s.out, "Tested %d images: %d PASS, %d FAIL and %d SKIP\n", len(results), len(results)-failures-skipped, failures, skipped)
+	fmt.Fprintln(s.out, total.String())
+	fmt.Fprintln(s.out, "----")
+
+	if failures > 0 || skipped > 0 {
+		// Keep the most severe error of the targets so that the caller can
+		// tell what went wrong.
+		if worst == nil {
+			worst = fmt.Errorf("tests failed")
+		}
+		return fmt.Errorf("%d of %d images failed and %d were skipped: %w", failures, len(results), skipped, worst)
+	}
+
+	return nil
+}
@@ -17,12 +17,12 @@ func (b *Builder) setTag(imgID, repo, tag string) error {
 	urlPath := fmt.Sprintf("/images/%s/tag?%s", imgID, query.Encode())
 	req, err := http.NewRequest("POST", b.client.URL.String()+urlPath, nil)
 	if err != nil {
-		return fmt.Errorf("unable to prepare request: %s", err)
+		return daemonErrorf("unable to prepare request: %s", err)
 	}
 
 	resp, err := b.client.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to make request: %s", err)
+		return daemonErrorf("unable to make request: %s", err)
 	}
 	defer resp.Body.Close()
 
@@ -31,7 +31,7 @@ func (b *Builder) setTag(imgID, repo, tag string) error {
 		buf := bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
 		io.Copy(buf, resp.Body) // It's okay if this fails.
 
-		return fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, buf.String())
+		return daemonErrorf("request failed with status code %d: %s", resp.StatusCode, buf.String())
 	}
 
 	return nil
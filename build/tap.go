@@ -0,0 +1,105 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// tapReporter writes the outcome of every assertion in the Test Anything
+// Protocol version 13 format. The plan is written last since the number of
+// assertions is only known once every Dockerfile has been tested.
+type tapReporter struct {
+	out     io.Writer
+	mu      sync.Mutex
+	started bool
+	count   int
+}
+
+// NewTAPReporter returns a reporter writing a TAP version 13 stream to out.
+func NewTAPReporter(out io.Writer) Reporter {
+	return &tapReporter{out: out}
+}
+
+func (r *tapReporter) Event(event *Event) {}
+
+func (r *tapReporter) Finish(results *TestResults) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeHeader()
+
+	fmt.Fprintf(r.out, "# %s\n", results.DockerfilePath)
+
+	for _, block := range results.Blocks {
+		for _, assertion := range block.Assertions {
+			r.count++
+			description := tapEscape(fmt.Sprintf("%s: %s", block.Name(), assertion.Assertion))
+
+			switch assertion.Status {
+			case StatusPassed:
+				fmt.Fprintf(r.out, "ok %d - %s\n", r.count, description)
+			case StatusSkipped:
+				reason := "not run"
+				if assertion.SkipReason != "" {
+					reason = assertion.SkipReason
+				}
+				fmt.Fprintf(r.out, "ok %d - %s # SKIP %s\n", r.count, description, tapEscape(reason))
+			default:
+				fmt.Fprintf(r.out, "not ok %d - %s\n", r.count, description)
+				r.writeDiagnostic(results, assertion)
+			}
+		}
+	}
+}
+
+func (r *tapReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeHeader()
+
+	_, err := fmt.Fprintf(r.out, "1..%d\n", r.count)
+
+	return err
+}
+
+func (r *tapReporter) writeHeader() {
+	if !r.started {
+		fmt.Fprintln(r.out, "TAP version 13")
+		r.started = true
+	}
+}
+
+// writeDiagnostic writes a YAML block describing a failed assertion.
+func (r *tapReporter) writeDiagnostic(results *TestResults, assertion *AssertionResult) {
+	fmt.Fprintln(r.out, "  ---")
+	fmt.Fprintf(r.out, "  message: %q\n", assertion.Failure)
+	fmt.Fprintf(r.out, "  file: %q\n", results.TestfilePath)
+	fmt.Fprintf(r.out, "  line: %d\n", assertion.Line)
+	fmt.Fprintf(r.out, "  duration_ms: %d\n", assertion.Duration.Nanoseconds()/1e6)
+	writeTAPBlockScalar(r.out, "stdout", assertion.Stdout)
+	writeTAPBlockScalar(r.out, "stderr", assertion.Stderr)
+	fmt.Fprintln(r.out, "  ...")
+}
+
+func writeTAPBlockScalar(out io.Writer, key, value string) {
+	if value == "" {
+		return
+	}
+
+	fmt.Fprintf(out, "  %s: |\n", key)
+	for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+}
+
+// tapEscape escapes the characters that have a meaning in a TAP test line
+// description.
+func tapEscape(description string) string {
+	description = strings.Replace(description, `\`, `\\`, -1)
+	description = strings.Replace(description, "#", `\#`, -1)
+
+	return strings.Replace(description, "\n", " ", -1)
+}
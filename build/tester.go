@@ -3,18 +3,22 @@ package build
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	dockerclient2 "github.com/fsouza/go-dockerclient"
 	"github.com/l0rd/docker-unit/build/commands"
 	"github.com/l0rd/docker-unit/build/parser"
+	"github.com/samalba/dockerclient"
 )
 
 type TestBlock struct {
 	Position      string
 	DockerfileRef string
+	Line          int
+	RunOptions    *RunOptions
 	Asserts       []parser.Command
 	Ephemerals    []parser.Command
 }
@@ -28,6 +32,7 @@ type TestStats struct {
 
 type DockerfileTests struct {
 	testBlocks []TestBlock
+	services   []Service
 }
 
 func newTester(testfilepath string) (*DockerfileTests, error) {
@@ -38,7 +43,12 @@ func newTester(testfilepath string) (*DockerfileTests, error) {
 	}
 	defer dockerTestfile.Close()
 
-	cmds, err := parser.Parse(dockerTestfile)
+	return parseTester(dockerTestfile)
+}
+
+// parseTester parses the tests read from r.
+func parseTester(r io.Reader) (*DockerfileTests, error) {
+	cmds, err := parser.Parse(r)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse DockerTestfile: %s", err)
 	}
@@ -56,12 +66,26 @@ func newTester(testfilepath string) (*DockerfileTests, error) {
 		Ephemerals: make([]parser.Command, 0),
 	}
 
-	for i, fullcmd := range cmds {
+	for _, fullcmd := range cmds {
 
 		cmd, args := strings.ToUpper(fullcmd.Args[0]), fullcmd.Args[1:]
 
-		if (i == 0) && ((cmd != commands.Before) && (cmd != commands.After) && (cmd != commands.AfterRun)) {
-			return nil, fmt.Errorf("Tests blocks should start with a %s, %s or %s command (found %s instead)", commands.Before, commands.After, commands.AfterRun, cmd)
+		if cmd == commands.Service {
+			service, err := parseService(args, fullcmd.Line)
+			if err != nil {
+				return nil, err
+			}
+			for _, declared := range t.services {
+				if declared.Name == service.Name {
+					return nil, fmt.Errorf("%s %s at line %d is already declared at line %d", commands.Service, service.Name, service.Line, declared.Line)
+				}
+			}
+			t.services = append(t.services, service)
+			continue
+		}
+
+		if _, newTestBlock := commands.NewTestBlock[cmd]; len(t.testBlocks) == 0 && currentTestBlock.Position == "" && !newTestBlock {
+			return nil, fmt.Errorf("Tests blocks should start with a %s, %s, %s, %s or %s command (found %s instead)", commands.Before, commands.After, commands.ExpectFailure, commands.AfterRun, commands.AfterRunExit, cmd)
 		}
 
 		if _, newTestBlock := commands.NewTestBlock[cmd]; newTestBlock {
@@ -73,14 +97,84 @@ func newTester(testfilepath string) (*DockerfileTests, error) {
 			currentTestBlock = &TestBlock{
 				Position: cmd,
 				//DockerfileRef: args[0],
+				Line:       fullcmd.Line,
 				Asserts:    make([]parser.Command, 0),
 				Ephemerals: make([]parser.Command, 0),
 			}
 
-			if len(args) > 0 {
+			if cmd == commands.AfterRun || cmd == commands.AfterRunExit {
+				runOptions, err := parseRunOptions(args)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s block at line %d: %s", cmd, fullcmd.Line, err)
+				}
+				currentTestBlock.RunOptions = runOptions
+			} else if cmd == commands.ExpectFailure {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("%s at line %d requires one and only one Dockerfile instruction reference", cmd, fullcmd.Line)
+				}
+				currentTestBlock.DockerfileRef = args[0]
+				// The expected failure is reported as the first assertion
+				// of the block.
+				currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+				currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, stepCheck(fullcmd))
+			} else if len(args) > 0 {
 				currentTestBlock.DockerfileRef = args[0]
 			}
 
+		} else if n := len(currentTestBlock.Asserts); n > 0 && isStopAssertion(&currentTestBlock.Asserts[n-1]) {
+			return nil, fmt.Errorf("%s at line %d must be the last assertion of its block", stopsGracefullyWithin, currentTestBlock.Asserts[n-1].Line)
+		} else if currentTestBlock.Position == commands.AfterRun && isStopAssertion(fullcmd) {
+			// The container is stopped in place rather than running a
+			// command in it.
+			if _, _, err := parseStopAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, parser.Command{Line: fullcmd.Line})
+		} else if currentTestBlock.Position == commands.AfterRun && isResourceAssertion(fullcmd) {
+			// The resources used by the container are checked with the
+			// daemon API rather than in the container.
+			if _, _, err := parseResourceAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, parser.Command{Line: fullcmd.Line})
+		} else if (currentTestBlock.Position == commands.After || currentTestBlock.Position == commands.ExpectFailure) && isStepAssertion(fullcmd) {
+			// Assertions about the outcome of the instruction are checked
+			// once it has run rather than in a container.
+			if err := validateStepAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, stepCheck(fullcmd))
+		} else if (currentTestBlock.Position == commands.Before || currentTestBlock.Position == commands.After) && isSnapshotAssertion(fullcmd) {
+			// The file tree of the image is exported rather than
+			// inspected in a container.
+			if err := validateSnapshotAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, snapshotCheck(fullcmd))
+		} else if isFileAssertion(fullcmd) {
+			// Files are read through the archive API rather than
+			// inspected in a container.
+			if err := validateFileAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			if currentTestBlock.Position == commands.AfterRun || currentTestBlock.Position == commands.AfterRunExit {
+				currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, parser.Command{Line: fullcmd.Line})
+			} else {
+				currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, fileCheck(fullcmd))
+			}
+		} else if currentTestBlock.Position == commands.AfterRunExit && isExitAssertion(fullcmd) {
+			// Assertions about the exit code and the output of the
+			// container are not run in a container.
+			if err := validateExitAssertion(fullcmd); err != nil {
+				return nil, err
+			}
+			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
+			currentTestBlock.Ephemerals = append(currentTestBlock.Ephemerals, parser.Command{Line: fullcmd.Line})
 		} else {
 			currentTestBlock.Asserts = append(currentTestBlock.Asserts, *fullcmd)
 			ephemerals, err := Assert2Ephemeral(fullcmd)
@@ -98,7 +192,16 @@ func newTester(testfilepath string) (*DockerfileTests, error) {
 }
 
 func Inject(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command, error) {
+	newCommands, _, err := injectTests(cmds, tests)
+	return newCommands, err
+}
+
+// injectTests injects the assertions of the test blocks around the Dockerfile
+// instructions they refer to, and returns which test blocks exercise every
+// instruction.
+func injectTests(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command, *Coverage, error) {
 	newCommands := make([]*parser.Command, 0)
+	coverage := &Coverage{}
 	foundTestBlocks := 0
 
 	for _, cmd := range cmds {
@@ -106,10 +209,16 @@ func Inject(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command,
 		cmdRef := toDockerfileRef(cmd)
 		matchedBeforeTestBlocks := make([]TestBlock, 0)
 		matchedAfterTestBlocks := make([]TestBlock, 0)
+		matchedExpectFailureTestBlocks := make([]TestBlock, 0)
+		instruction := &InstructionCoverage{Line: cmd.Line, Instruction: instructionString(cmd)}
+		coverage.Instructions = append(coverage.Instructions, instruction)
 
 		for _, testBlock := range tests.testBlocks {
 			if strings.HasPrefix(cmdRef, testBlock.DockerfileRef) {
 				foundTestBlocks++
+				if coversInstructions(&testBlock) {
+					instruction.Blocks = append(instruction.Blocks, testBlock.Position+" "+testBlock.DockerfileRef)
+				}
 				if testBlock.Position == commands.Before {
 					matchedBeforeTestBlocks = append(matchedBeforeTestBlocks, testBlock)
 				}
@@ -117,11 +226,15 @@ func Inject(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command,
 				if testBlock.Position == commands.After {
 					matchedAfterTestBlocks = append(matchedAfterTestBlocks, testBlock)
 				}
+
+				if testBlock.Position == commands.ExpectFailure {
+					matchedExpectFailureTestBlocks = append(matchedExpectFailureTestBlocks, testBlock)
+				}
 			}
 		}
 
-		if len(matchedBeforeTestBlocks) > 1 || len(matchedAfterTestBlocks) > 1 {
-			return nil, fmt.Errorf("Found more than one before/after test block that match a command (%s)", cmdRef)
+		if len(matchedBeforeTestBlocks) > 1 || len(matchedAfterTestBlocks) > 1 || len(matchedExpectFailureTestBlocks) > 1 {
+			return nil, nil, fmt.Errorf("Found more than one before/after/expect failure test block that match a command (%s)", cmdRef)
 		}
 
 		if len(matchedBeforeTestBlocks) == 1 {
@@ -132,6 +245,12 @@ func Inject(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command,
 
 		newCommands = append(newCommands, cmd)
 
+		if len(matchedExpectFailureTestBlocks) == 1 {
+			for i, _ := range matchedExpectFailureTestBlocks[0].Ephemerals {
+				newCommands = append(newCommands, &matchedExpectFailureTestBlocks[0].Ephemerals[i])
+			}
+		}
+
 		if len(matchedAfterTestBlocks) == 1 {
 			for i, _ := range matchedAfterTestBlocks[0].Ephemerals {
 				newCommands = append(newCommands, &matchedAfterTestBlocks[0].Ephemerals[i])
@@ -140,16 +259,41 @@ func Inject(cmds []*parser.Command, tests *DockerfileTests) ([]*parser.Command,
 	}
 
 	if foundTestBlocks < len(tests.testBlocks) {
-		return nil, fmt.Errorf("Some tests blocks could not be matched with Dockerfile instructions")
+		return nil, nil, fmt.Errorf("Some tests blocks could not be matched with Dockerfile instructions")
 	}
 
-	return newCommands, nil
+	return newCommands, coverage, nil
 }
 
 func toDockerfileRef(command *parser.Command) string {
 	return strings.ToUpper(strings.Join(command.Args, "_"))
 }
 
+// checkAssertPrefix returns an error if an assertion does not start with
+// ASSERT_TRUE or ASSERT_FALSE.
+func checkAssertPrefix(command *parser.Command) error {
+	if command.Args[0] != commands.AssertTrue && command.Args[0] != commands.AssertFalse {
+		return fmt.Errorf("Asserts should start with %s or %s. Current assert starts with %s", commands.AssertTrue, commands.AssertFalse, command.Args[0])
+	}
+
+	return nil
+}
+
+// checkHolds returns an error if the condition of an assertion starting with
+// prefix does not hold, or holds for ASSERT_FALSE. The error describes what was
+// expected: description for ASSERT_TRUE and negated for ASSERT_FALSE.
+func checkHolds(prefix string, holds bool, description, negated string) error {
+	if prefix == commands.AssertFalse {
+		holds = !holds
+		description = negated
+	}
+	if !holds {
+		return fmt.Errorf("expected %s", description)
+	}
+
+	return nil
+}
+
 func Assert2Ephemeral(command *parser.Command) (*parser.Command, error) {
 	ephemeral := &parser.Command{Args: []string{"EPHEMERAL"}}
 
@@ -157,8 +301,8 @@ func Assert2Ephemeral(command *parser.Command) (*parser.Command, error) {
 		return nil, fmt.Errorf("Failed to convert an Assert command into an ephemeral: assert args is < 2 (assert=%s)", command.Args)
 	}
 
-	if command.Args[0] != commands.AssertTrue && command.Args[0] != commands.AssertFalse {
-		return nil, fmt.Errorf("Asserts should start with %s or %s. Current assert starts with %s)", commands.AssertTrue, commands.AssertFalse, command.Args[0])
+	if err := checkAssertPrefix(command); err != nil {
+		return nil, err
 	}
 
 	switch command.Args[1] {
@@ -235,8 +379,21 @@ func Assert2Ephemeral(command *parser.Command) (*parser.Command, error) {
 		isInstalledGeneric(command.Args[2])
 		ephemeral.Args = append(ephemeral.Args, test)
 
+	case "NO_ZOMBIE_PROCESSES":
+		if len(command.Args) != 2 {
+			return nil, fmt.Errorf("Condition %s accept no argument (found %d)", "NO_ZOMBIE_PROCESSES", len(command.Args)-2)
+		}
+		ephemeral.Args = append(ephemeral.Args, "sh", "-c")
+		// The state of a process is the first field following its
+		// name, between parentheses, in /proc/<pid>/stat.
+		test := "cat /proc/[0-9]*/stat 2>/dev/null | sed 's/.*) //' | cut -d ' ' -f 1 | grep -q Z"
+		if command.Args[0] == commands.AssertTrue {
+			test = "! " + test
+		}
+		ephemeral.Args = append(ephemeral.Args, test)
+
 	default:
-		return nil, fmt.Errorf("Condition %s is not supported. Only %s, %s, %s, %s, %s and %s are currently supported. Please open an issue if you want to add support for it.", command.Args[1], "USER_EXISTS", "FILE_EXISTS", "CURRENT_USER_IS", "IS_INSTALLED", "FILE_CONTAINS", "PROCESS_EXISTS")
+		return nil, fmt.Errorf("Condition %s is not supported. Only %s, %s, %s, %s, %s, %s and %s are currently supported. Please open an issue if you want to add support for it.", command.Args[1], "USER_EXISTS", "FILE_EXISTS", "CURRENT_USER_IS", "IS_INSTALLED", "FILE_CONTAINS", "PROCESS_EXISTS", "NO_ZOMBIE_PROCESSES")
 	}
 
 	return ephemeral, nil
@@ -251,8 +408,15 @@ func GetTotalNumberOfTests(tests *DockerfileTests) int {
 }
 
 func (b *Builder) TestsStatsString() (result string) {
-	result = fmt.Sprintf("Run %d tests: %d PASS and %d FAIL", b.dockerfileTestStats.NumberOfTestRan, b.dockerfileTestStats.NumberOfTestPassed, b.dockerfileTestStats.NumberOfTestFailed)
-	return result
+	if b.testResults == nil {
+		return TestStats{}.String()
+	}
+
+	return b.testResults.Stats().String()
+}
+
+func (s TestStats) String() string {
+	return fmt.Sprintf("Run %d tests: %d PASS and %d FAIL", s.NumberOfTestRan, s.NumberOfTestPassed, s.NumberOfTestFailed)
 }
 
 // func isInstalledDebian(packagename string) string {
@@ -265,40 +429,228 @@ func isInstalledGeneric(packagename string) string {
 	return "command -v \"" + packagename + "\"  1>/dev/null 2>&1"
 }
 
-func (b *Builder) dispatchPostBuildTests() error {
+func (b *Builder) dispatchPostBuildTests() (err error) {
+
+	if b.dockerfileTests == nil {
+		return nil
+	}
+
+	// Start the services only if a container runs along with them.
+	var services []Service
+	for _, testblock := range b.dockerfileTests.testBlocks {
+		if testblock.Position == commands.AfterRun || testblock.Position == commands.AfterRunExit {
+			services = b.dockerfileTests.services
+		}
+	}
+
+	teardown, err := b.startServices(services)
+	defer func() {
+		if teardownErr := teardown(); err == nil {
+			err = teardownErr
+		}
+	}()
+	if err != nil {
+		return err
+	}
 
 	for i, testblock := range b.dockerfileTests.testBlocks {
-		if testblock.Position == commands.AfterRun {
-			for _, ephemeral := range testblock.Ephemerals {
-				b.dockerfileTestStats.NumberOfTestRan++
-				if err := b.handlePostBuildTest(i, ephemeral.Args[1:]); err != nil {
-					b.dockerfileTestStats.NumberOfTestFailed++
-					return err
-				}
-				b.dockerfileTestStats.NumberOfTestPassed++
+		switch testblock.Position {
+		case commands.AfterRun, commands.AfterRunExit:
+			if b.reuseBlock(i, &testblock) {
+				continue
 			}
 		}
+
+		switch testblock.Position {
+		case commands.AfterRun:
+			if err := b.runPostBuildTestBlock(i, testblock); err != nil {
+				return err
+			}
+			b.rememberBlock(i, &testblock)
+		case commands.AfterRunExit:
+			if err := b.runExitTestBlock(i, testblock); err != nil {
+				return err
+			}
+			b.rememberBlock(i, &testblock)
+		}
 	}
 	return nil
 }
 
-func (b *Builder) handlePostBuildTest(index int, args []string) error {
+// postBuildConfig returns the configuration of the container started from the
+// built image with the options of an @AFTER_RUN or @AFTER_RUN_EXIT block. Its
+// stdin is kept open so that a shell command does not exit right away.
+func (b *Builder) postBuildConfig(testblock TestBlock) (*dockerclient.ContainerConfig, error) {
+	runOptions := testblock.RunOptions
+	if runOptions == nil {
+		runOptions = &RunOptions{}
+	}
 
-	log.Debugf("handling post build test with args: %#v", args)
+	config, err := runOptions.containerConfig(b.config.toDocker(), b.contextDirectory)
+	if err != nil {
+		return nil, configErrorf("invalid %s block at line %d: %s", testblock.Position, testblock.Line, err)
+	}
+	config.Image = b.imageID
+	config.OpenStdin = true
+	config.StdinOnce = true
 
-	if len(args) < 1 {
-		return fmt.Errorf("%s requires at least one argument", commands.Run)
+	return config, nil
+}
+
+// runPostBuildTestBlock starts a container from the built image with the
+// options of an @AFTER_RUN block and runs every assertion of the block in it.
+func (b *Builder) runPostBuildTestBlock(index int, testblock TestBlock) (err error) {
+	config, err := b.postBuildConfig(testblock)
+	if err != nil {
+		return err
 	}
 
-	fmt.Fprintf(b.out, "\nPost Build Test %d: running container (entrypoing:%s , cmd:%s)\n", index, b.config.Entrypoint, b.config.Cmd)
+	fmt.Fprintf(b.out, "\nPost Build Test %d: running container (entrypoint: %s, cmd: %s)\n", index, config.Entrypoint, config.Cmd)
 
-	containerID, err := b.createContainer(b.config.Entrypoint, b.config.Cmd, true)
+	containerID, err := b.createTrackedContainer(config, false)
 	if err != nil {
-		return fmt.Errorf("unable to create container: %s", err)
+		return daemonErrorf("unable to create container: %s", err)
+	}
+	keep := false
+	defer func() {
+		if keep {
+			return
+		}
+		if removeErr := b.removePostBuildContainer(containerID); err == nil {
+			err = removeErr
+		}
+	}()
+
+	if err := b.connectServiceNetwork(containerID); err != nil {
+		return err
 	}
 
 	if err := b.client.StartContainer(containerID, nil); err != nil {
-		return fmt.Errorf("unable to start container: %s", err)
+		return daemonErrorf("unable to start container: %s", err)
+	}
+
+	for j, ephemeral := range testblock.Ephemerals {
+		ref := assertionRef{
+			block:  b.testResults.Blocks[index],
+			result: b.testResults.Blocks[index].Assertions[j],
+		}
+		start := time.Now()
+
+		b.startAssertion(ref)
+		var err error
+		if isStopAssertion(&testblock.Asserts[j]) {
+			err = b.checkGracefulStop(containerID, &testblock.Asserts[j], ref.result)
+		} else if isResourceAssertion(&testblock.Asserts[j]) {
+			err = b.checkResource(containerID, &testblock.Asserts[j], ref.result)
+		} else if isFileAssertion(&testblock.Asserts[j]) {
+			err = b.checkFile(containerID, &testblock.Asserts[j], ref.result)
+		} else {
+			err = b.handlePostBuildTest(index, containerID, ephemeral.Args[1:], ref.result)
+		}
+		b.finishAssertion(ref, start, err)
+
+		if err != nil {
+			err = stepError(-1, ref.result.Assertion, &ref, err)
+			b.keepFailure(&ref, containerID, b.imageID, err)
+			if !b.debugging(err) {
+				return err
+			}
+
+			// The running container is kept to be debugged.
+			keep = true
+			if err := b.debugFailure(&ref, debugCommand(&ephemeral, &ref), b.imageID, containerID, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printAssertion prints the outcome of an assertion along with its output if
+// it failed or if the builder is verbose.
+func (b *Builder) printAssertion(result *AssertionResult) {
+	if result.Cached {
+		fmt.Fprintf(b.out, " --- %s: %s (cached pass)\n", result.Status, result.Assertion)
+	} else {
+		fmt.Fprintf(b.out, " --- %s: %s (%.2fs)\n", result.Status, result.Assertion, result.Duration.Seconds())
+	}
+
+	if result.Status == StatusPassed && !b.verbose {
+		return
+	}
+
+	printIndented(b.out, "stdout", result.Stdout)
+	printIndented(b.out, "stderr", result.Stderr)
+}
+
+func printIndented(out io.Writer, name, output string) {
+	if output == "" {
+		return
+	}
+
+	fmt.Fprintf(out, "     %s:\n", name)
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		fmt.Fprintf(out, "       %s\n", line)
+	}
+}
+
+// assertionRef links an assertion result to the result of its test block.
+type assertionRef struct {
+	block  *BlockResult
+	result *AssertionResult
+}
+
+func (b *Builder) startAssertion(ref assertionRef) {
+	b.currentAssertion = &ref
+
+	b.emit(&Event{
+		Type:      EventAssertionStarted,
+		Block:     ref.block.Name(),
+		Assertion: ref.result.Assertion,
+		Line:      ref.result.Line,
+	})
+}
+
+// finishAssertion records the outcome of an assertion that started at start
+// and failed if err is not nil.
+func (b *Builder) finishAssertion(ref assertionRef, start time.Time, err error) {
+	b.currentAssertion = nil
+
+	ref.result.ImageID = b.imageID
+	ref.result.Duration = time.Since(start)
+	ref.result.Status = StatusPassed
+	if err != nil {
+		ref.result.Status = StatusFailed
+		ref.result.Failure = err.Error()
+	}
+
+	b.printAssertion(ref.result)
+
+	event := &Event{
+		Type:      EventAssertionPassed,
+		Block:     ref.block.Name(),
+		Assertion: ref.result.Assertion,
+		Line:      ref.result.Line,
+		Duration:  ref.result.Duration,
+		Failure:   ref.result.Failure,
+		Stdout:    ref.result.Stdout,
+		Stderr:    ref.result.Stderr,
+	}
+	if err != nil {
+		event.Type = EventAssertionFailed
+	}
+	b.emit(event)
+}
+
+// handlePostBuildTest runs the command of an assertion in the running
+// container of an @AFTER_RUN block.
+func (b *Builder) handlePostBuildTest(index int, containerID string, args []string, result *AssertionResult) error {
+
+	b.logger.Debugf("handling post build test with args: %#v", args)
+
+	if len(args) < 1 {
+		return fmt.Errorf("%s requires at least one argument", commands.Run)
 	}
 
 	createExecConfig := dockerclient2.CreateExecOptions{
@@ -315,7 +667,7 @@ func (b *Builder) handlePostBuildTest(index int, args []string) error {
 
 	createExecResult, err := b.client2.CreateExec(createExecConfig)
 	if err != nil {
-		return fmt.Errorf("unable to exec assert in running container: %s", err)
+		return daemonErrorf("unable to exec assert in running container: %s", err)
 	}
 
 	var stdout, stderr bytes.Buffer
@@ -323,30 +675,36 @@ func (b *Builder) handlePostBuildTest(index int, args []string) error {
 		OutputStream: &stdout,
 		ErrorStream:  &stderr,
 		//InputStream:  nil,
-		RawTerminal: true,
+		RawTerminal: false,
 	}
 
 	err = b.client2.StartExec(createExecResult.ID, startExecConfig)
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
 	if err != nil {
-		return fmt.Errorf("unable to exec assert in running container: %s", err)
+		return daemonErrorf("unable to exec assert in running container: %s", err)
 	}
 
 	inspectResult, err := b.client2.InspectExec(createExecResult.ID)
 	if err != nil {
-		return fmt.Errorf("unable to exec assert in running container: %s", err)
+		return daemonErrorf("unable to exec assert in running container: %s", err)
 	}
 
 	if inspectResult.ExitCode != 0 {
 		return fmt.Errorf("assert \"%s\" failed, return code: %d", args, inspectResult.ExitCode)
 	}
 
+	return nil
+}
+
+// removePostBuildContainer stops and removes the container of an @AFTER_RUN
+// block.
+func (b *Builder) removePostBuildContainer(containerID string) error {
 	if err := b.client.StopContainer(containerID, 1); err != nil {
-		return fmt.Errorf("unable to stop/kill container: %s", err)
+		return daemonErrorf("unable to stop/kill container: %s", err)
 	}
 
-	err = b.client.RemoveContainer(containerID, true, true)
-	if err != nil {
-		return fmt.Errorf("unable to inspect container: %s", err)
+	if err := b.removeContainer(containerID); err != nil {
+		return daemonErrorf("unable to remove container: %s", err)
 	}
 
 	return nil
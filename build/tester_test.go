@@ -1,8 +1,11 @@
 package build
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/l0rd/docker-unit/build/parser"
 )
@@ -22,7 +25,7 @@ func TestNewTester(t *testing.T) {
 	}
 
 	if tests == nil {
-		t.Errorf("Failed to test file %s", tests)
+		t.Errorf("Failed to test file %v", tests)
 	}
 
 	if blockNum := len(tests.testBlocks); blockNum != 8 {
@@ -30,6 +33,39 @@ func TestNewTester(t *testing.T) {
 	}
 }
 
+func TestParseAfterRunOptions(t *testing.T) {
+	tests, err := parseTester(strings.NewReader("@AFTER_RUN --env FOO=bar --publish 8080:80\nASSERT_TRUE PROCESS_EXISTS nginx\n"))
+	if err != nil {
+		t.Fatalf("unable to parse tests: %s", err)
+	}
+
+	block := tests.testBlocks[0]
+	if block.DockerfileRef != "" || block.RunOptions == nil || block.RunOptions.Env[0] != "FOO=bar" || block.RunOptions.Publish[0] != "8080:80" {
+		t.Errorf("Unexpected @AFTER_RUN block: %+v", block)
+	}
+
+	if _, err := parseTester(strings.NewReader("@AFTER_RUN --unknown\nASSERT_TRUE PROCESS_EXISTS nginx\n")); err == nil {
+		t.Errorf("Expected an error for an unknown @AFTER_RUN option")
+	}
+}
+
+func TestPostBuildConfig(t *testing.T) {
+	b := &Builder{imageID: "sha256:1", config: &config{Cmd: []string{"/bin/bash"}}}
+
+	for _, position := range []string{"@AFTER_RUN", "@AFTER_RUN_EXIT"} {
+		config, err := b.postBuildConfig(TestBlock{Position: position, RunOptions: &RunOptions{Env: []string{"FOO=bar"}}})
+		if err != nil {
+			t.Fatalf("Unexpected error for a %s block: %s", position, err)
+		}
+		if config.Image != "sha256:1" || config.Cmd[0] != "/bin/bash" || config.Env[0] != "FOO=bar" {
+			t.Errorf("Unexpected container configuration for a %s block: %+v", position, config)
+		}
+		if !config.OpenStdin || !config.StdinOnce {
+			t.Errorf("Expected the stdin of the container of a %s block to be kept open", position)
+		}
+	}
+}
+
 func TestInjection(t *testing.T) {
 
 	expectedEphemerals := []parser.Command{
@@ -133,17 +169,73 @@ func TestAssert2Ephemeral(t *testing.T) {
 		}
 
 		if len(actual.Args) != len(c.expected.Args) {
-			t.Errorf("Assert2Ephemeral(%q) == %q, expected %q", c.in, actual, c.expected)
+			t.Errorf("Assert2Ephemeral(%v) == %v, expected %v", c.in, actual, c.expected)
 		}
 
 		for i, arg := range actual.Args {
 			if arg != c.expected.Args[i] {
-				t.Errorf("Assert2Ephemeral(%q) == %q, expected %q", c.in, actual, c.expected)
+				t.Errorf("Assert2Ephemeral(%v) == %v, expected %v", c.in, actual, c.expected)
 			}
 		}
 	}
 }
 
+func TestCheckAssertPrefix(t *testing.T) {
+	if err := checkAssertPrefix(&parser.Command{Args: []string{"ASSERT_FALSE", "USER_EXISTS", "tomcat"}}); err != nil {
+		t.Errorf("Unexpected error for an ASSERT_FALSE assertion: %s", err)
+	}
+
+	err := checkAssertPrefix(&parser.Command{Args: []string{"EXPECT", "USER_EXISTS", "tomcat"}})
+	if err == nil || err.Error() != "Asserts should start with ASSERT_TRUE or ASSERT_FALSE. Current assert starts with EXPECT" {
+		t.Errorf("Unexpected error for an assertion with an unknown prefix: %v", err)
+	}
+}
+
+func TestCheckHolds(t *testing.T) {
+	if err := checkHolds("ASSERT_TRUE", true, "a", "not a"); err != nil {
+		t.Errorf("Unexpected error for an ASSERT_TRUE condition that holds: %s", err)
+	}
+	if err := checkHolds("ASSERT_TRUE", false, "a", "not a"); err == nil || err.Error() != "expected a" {
+		t.Errorf("Unexpected error for an ASSERT_TRUE condition that does not hold: %v", err)
+	}
+	if err := checkHolds("ASSERT_FALSE", false, "a", "not a"); err != nil {
+		t.Errorf("Unexpected error for an ASSERT_FALSE condition that does not hold: %s", err)
+	}
+	if err := checkHolds("ASSERT_FALSE", true, "a", "not a"); err == nil || err.Error() != "expected not a" {
+		t.Errorf("Unexpected error for an ASSERT_FALSE condition that holds: %v", err)
+	}
+}
+
+func TestPrintAssertion(t *testing.T) {
+	var buf bytes.Buffer
+	b := &Builder{out: &buf}
+
+	passed := &AssertionResult{Assertion: "ASSERT_TRUE USER_EXISTS mario", Status: StatusPassed, Duration: 250 * time.Millisecond, Stdout: "mario:x:1000:1000::/home/mario:/bin/bash\n"}
+	failed := &AssertionResult{Assertion: "ASSERT_TRUE FILE_EXISTS /foo", Status: StatusFailed, Stdout: "out\n", Stderr: "line 1\nline 2\n"}
+
+	b.printAssertion(passed)
+	b.printAssertion(failed)
+
+	expected := " --- PASS: ASSERT_TRUE USER_EXISTS mario (0.25s)\n" +
+		" --- FAIL: ASSERT_TRUE FILE_EXISTS /foo (0.00s)\n" +
+		"     stdout:\n" +
+		"       out\n" +
+		"     stderr:\n" +
+		"       line 1\n" +
+		"       line 2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nfound:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	b.verbose = true
+	b.printAssertion(passed)
+
+	if !strings.Contains(buf.String(), "mario:x:1000") {
+		t.Errorf("Expected the output of a passing assertion in verbose mode, found:\n%s", buf.String())
+	}
+}
+
 func printCommands(t *testing.T, commands []*parser.Command) {
 
 	for _, cmd := range commands {
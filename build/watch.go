@@ -0,0 +1,315 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/l0rd/docker-unit/build/commands"
+	"github.com/l0rd/docker-unit/build/parser"
+)
+
+// watchInterval is how often the watched files are checked for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watchOutputLines is the number of lines of the build output printed when
+// the build fails.
+const watchOutputLines = 15
+
+// Watcher builds and tests a Dockerfile again every time the Dockerfile, its
+// test file or the files of the build context it uses change.
+type Watcher struct {
+	contextDirectory string
+	options          []Option
+	interval         time.Duration
+
+	// passedResults keeps the outcome of the assertions that passed across
+	// the iterations when the test cache file is not used.
+	passedResults map[string]*AssertionResult
+
+	out io.Writer
+}
+
+// fileState is what tells that a watched file changed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// NewWatcher creates a watcher of the Dockerfile and the test file set by
+// the options, which are used to create the builder of every iteration. The
+// iterations are built without reporters.
+func NewWatcher(contextDirectory string, options ...Option) *Watcher {
+	return &Watcher{
+		contextDirectory: contextDirectory,
+		options:          options,
+		interval:         watchInterval,
+		passedResults:    map[string]*AssertionResult{},
+		out:              os.Stdout,
+	}
+}
+
+// Run builds and tests the Dockerfile, then again after every change of the
+// watched files, until stop is closed. Only the errors preventing the first
+// iteration to start are returned: the later ones are printed and the files
+// are still watched.
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	var paths []string
+
+	for {
+		b, err := w.newBuilder()
+		if err != nil {
+			if paths == nil {
+				return err
+			}
+			fmt.Fprintf(w.out, "[%s] ERROR %s\n", time.Now().Format("15:04:05"), err)
+		} else {
+			paths = watchedPaths(b)
+			before := snapshotFiles(paths)
+			w.runIteration(b)
+
+			// Files changed during the iteration are not tested yet.
+			if !sameFiles(before, snapshotFiles(paths)) {
+				continue
+			}
+		}
+
+		fmt.Fprintf(w.out, "Watching %d files for changes\n", len(snapshotFiles(paths)))
+		if !w.waitForChange(paths, stop) {
+			return nil
+		}
+	}
+}
+
+// newBuilder creates the builder of an iteration, printing its output only
+// if it fails.
+func (w *Watcher) newBuilder() (*Builder, error) {
+	options := append([]Option{}, w.options...)
+	options = append(options,
+		WithOutput(&bytes.Buffer{}),
+		asWatchIteration(w.passedResults),
+	)
+
+	return NewBuilder(w.contextDirectory, options...)
+}
+
+// asWatchIteration removes the reporters set by the previous options, which
+// would report every iteration. Without the test cache file, the assertions
+// that passed are kept in passedResults so that only the blocks affected by a
+// change run again.
+func asWatchIteration(passedResults map[string]*AssertionResult) Option {
+	return func(b *Builder) error {
+		b.reporters = nil
+		if b.noTestCache {
+			b.passedResults = passedResults
+		}
+		return nil
+	}
+}
+
+// runIteration builds and tests the Dockerfile and prints a summary of the
+// outcome.
+func (w *Watcher) runIteration(b *Builder) {
+	results, err := b.Test()
+	fmt.Fprintln(w.out, summarizeIteration(results, err))
+
+	if err == nil {
+		return
+	}
+
+	var assertionErr *AssertionFailedError
+	if errors.As(err, &assertionErr) {
+		for _, block := range results.Blocks {
+			for _, assertion := range block.Assertions {
+				if assertion.Status != StatusFailed {
+					continue
+				}
+				fmt.Fprintf(w.out, "  %s line %d: %s\n", block.Name(), assertion.Line, assertion.Assertion)
+				fmt.Fprintf(w.out, "    %s\n", assertion.Failure)
+				printIndented(w.out, "stdout", assertion.Stdout)
+				printIndented(w.out, "stderr", assertion.Stderr)
+			}
+		}
+		return
+	}
+
+	fmt.Fprintf(w.out, "  %s\n", err)
+	if out, ok := b.out.(*bytes.Buffer); ok {
+		lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+		if len(lines) > watchOutputLines {
+			lines = lines[len(lines)-watchOutputLines:]
+		}
+		for _, line := range lines {
+			fmt.Fprintf(w.out, "  | %s\n", line)
+		}
+	}
+}
+
+// summarizeIteration returns the outcome of an iteration on a single line:
+//
+//	[15:04:05] PASS 7 steps (6 cached), 12 assertions: 12 passed (9 cached) in 3.2s
+func summarizeIteration(results *TestResults, err error) string {
+	status := "PASS"
+	if err != nil {
+		status = "ERROR"
+		var assertionErr *AssertionFailedError
+		if errors.As(err, &assertionErr) {
+			status = "FAIL"
+		}
+	}
+
+	cachedSteps := 0
+	for _, step := range results.Steps {
+		if step.CacheHit {
+			cachedSteps++
+		}
+	}
+
+	cachedAssertions := 0
+	for _, block := range results.Blocks {
+		for _, assertion := range block.Assertions {
+			if assertion.Cached {
+				cachedAssertions++
+			}
+		}
+	}
+
+	stats := results.Stats()
+	summary := fmt.Sprintf("[%s] %s %d steps (%d cached), %d assertions: %d passed (%d cached)",
+		time.Now().Format("15:04:05"), status, len(results.Steps), cachedSteps,
+		stats.TotalNumberOfTests, stats.NumberOfTestPassed, cachedAssertions)
+	if stats.NumberOfTestFailed > 0 {
+		summary += fmt.Sprintf(", %d failed", stats.NumberOfTestFailed)
+	}
+	if skipped := stats.TotalNumberOfTests - stats.NumberOfTestRan; skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+
+	return summary + fmt.Sprintf(" in %.1fs", results.Duration.Seconds())
+}
+
+// waitForChange returns true once the watched files changed and then stayed
+// the same for an interval, and false if stop is closed first.
+func (w *Watcher) waitForChange(paths []string, stop <-chan struct{}) bool {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	before := snapshotFiles(paths)
+	changed := false
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+
+		current := snapshotFiles(paths)
+		if sameFiles(before, current) {
+			if changed {
+				return true
+			}
+			continue
+		}
+
+		// Wait for the editor or the tool changing the files to be done.
+		before, changed = current, true
+	}
+}
+
+// watchedPaths returns the files a build depends on: the Dockerfile, its test
+// file and the sources of the COPY and EXTRACT instructions, along with the
+// files of the build context read by the tests and the snapshot golden files.
+func watchedPaths(b *Builder) []string {
+	paths := []string{b.dockerfilePath, b.dockerfilePath + testfileSuffix}
+	if b.dockerTestfilePath != "" && b.dockerTestfile == nil {
+		paths = append(paths, b.dockerTestfilePath)
+	}
+
+	contextPath := func(p string) {
+		if insideContext(p) {
+			paths = append(paths, filepath.Join(b.contextDirectory, p))
+		}
+	}
+
+	if dockerfile, err := os.Open(b.dockerfilePath); err == nil {
+		cmds, err := parser.Parse(dockerfile)
+		dockerfile.Close()
+		if err == nil {
+			for _, cmd := range cmds {
+				switch strings.ToUpper(cmd.Args[0]) {
+				case commands.Copy, commands.Extract:
+					if len(cmd.Args) >= 3 {
+						for _, src := range cmd.Args[1 : len(cmd.Args)-1] {
+							contextPath(src)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var tests *DockerfileTests
+	if b.dockerTestfile != nil {
+		tests, _ = parseTester(bytes.NewReader(b.dockerTestfile))
+	} else if b.dockerTestfilePath != "" {
+		tests, _ = newTester(b.dockerTestfilePath)
+	}
+	if tests != nil {
+		for _, testblock := range tests.testBlocks {
+			if testblock.RunOptions != nil {
+				for _, volume := range testblock.RunOptions.Volumes {
+					if src, _, _, err := parseVolume(volume); err == nil {
+						contextPath(src)
+					}
+				}
+			}
+			for _, assert := range testblock.Asserts {
+				if (isContextFileAssertion(&assert) || isSnapshotAssertion(&assert)) && len(assert.Args) > 2 {
+					contextPath(assert.Args[2])
+				}
+			}
+		}
+	}
+
+	return paths
+}
+
+// snapshotFiles returns the state of the watched files, and of every file
+// under the watched directories. The missing files are left out.
+func snapshotFiles(paths []string) map[string]fileState {
+	snapshot := map[string]fileState{}
+
+	for _, root := range paths {
+		filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			snapshot[p] = fileState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+			return nil
+		})
+	}
+
+	return snapshot
+}
+
+// sameFiles returns whether two snapshots of the watched files are the same.
+func sameFiles(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, state := range a {
+		other, ok := b[p]
+		if !ok || other.size != state.size || !other.modTime.Equal(state.modTime) || other.mode != state.mode {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,178 @@
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchedPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM ubuntu:14.04\nCOPY conf /etc/app\nEXTRACT app.tar.gz /opt\nCOPY ../outside /tmp\nCOPY a.sh b.sh /usr/local/bin/\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+	testfile := filepath.Join(dir, "app_test")
+	if err := ioutil.WriteFile(testfile, []byte("@AFTER_RUN --volume data:/data\n"+
+		"ASSERT_TRUE FILE_MATCHES_CONTEXT conf/app.ini /etc/app/app.ini\n\n"+
+		"@AFTER COPY_CONF\nASSERT_TRUE SNAPSHOT_MATCHES golden/etc.txt /etc\n"), 0644); err != nil {
+		t.Fatalf("unable to write test file: %s", err)
+	}
+
+	b := &Builder{contextDirectory: dir, dockerfilePath: dockerfile, dockerTestfilePath: testfile}
+	paths := watchedPaths(b)
+	sort.Strings(paths)
+
+	expected := []string{"Dockerfile", "Dockerfile_test", "a.sh", "app.tar.gz", "app_test", "b.sh", "conf", "conf/app.ini", "data", "golden/etc.txt"}
+	for i := range expected {
+		expected[i] = filepath.Join(dir, expected[i])
+	}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected watched paths %q, found %q", expected, paths)
+	}
+}
+
+func TestWatchIterationsWithoutTestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM debian\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+
+	cacheFilePath := filepath.Join(dir, "cache")
+	w := NewWatcher(dir, WithDaemon("tcp://127.0.0.1:2376", nil), WithCacheFile(cacheFilePath), WithTestCache(false))
+
+	first, err := w.newBuilder()
+	if err != nil {
+		t.Fatalf("unable to create builder: %s", err)
+	}
+	first.rememberResult("key", &AssertionResult{Assertion: "ASSERT_TRUE USER_EXISTS 'www-data'", Status: StatusPassed})
+	if err := first.saveTestCache(); err != nil {
+		t.Fatalf("Unexpected error saving the results of an iteration: %s", err)
+	}
+	if _, err := os.Stat(cacheFilePath + testCacheSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no test cache file to be written, found %v", err)
+	}
+
+	second, err := w.newBuilder()
+	if err != nil {
+		t.Fatalf("unable to create builder: %s", err)
+	}
+	if _, ok := second.passedResults["key"]; !ok {
+		t.Errorf("Expected the results that passed to be kept for the next iteration")
+	}
+}
+
+func TestSnapshotFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "conf")
+	if err := os.Mkdir(conf, 0755); err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(conf, "app.ini"), []byte("a=1\n"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+
+	paths := []string{conf, filepath.Join(dir, "missing")}
+	before := snapshotFiles(paths)
+	if len(before) != 2 {
+		t.Fatalf("Expected the directory and its file in the snapshot, found %d files", len(before))
+	}
+	if !sameFiles(before, snapshotFiles(paths)) {
+		t.Errorf("Expected the same snapshot without changes")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(conf, "app.ini"), []byte("a=10\n"), 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if sameFiles(before, snapshotFiles(paths)) {
+		t.Errorf("Expected a different snapshot once a file changed")
+	}
+
+	before = snapshotFiles(paths)
+	if err := ioutil.WriteFile(filepath.Join(dir, "missing"), nil, 0644); err != nil {
+		t.Fatalf("unable to write file: %s", err)
+	}
+	if sameFiles(before, snapshotFiles(paths)) {
+		t.Errorf("Expected a different snapshot once a missing file is created")
+	}
+}
+
+func TestWaitForChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatalf("unable to create context directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &Watcher{interval: 10 * time.Millisecond}
+	paths := []string{filepath.Join(dir, "Dockerfile")}
+
+	changed := make(chan bool)
+	go func() {
+		changed <- w.waitForChange(paths, nil)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	if err := ioutil.WriteFile(paths[0], []byte("FROM ubuntu:14.04\n"), 0644); err != nil {
+		t.Fatalf("unable to write Dockerfile: %s", err)
+	}
+
+	select {
+	case ok := <-changed:
+		if !ok {
+			t.Errorf("Expected a change to be detected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a change to be detected")
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if w.waitForChange(paths, stop) {
+		t.Errorf("Expected no change once stopped")
+	}
+}
+
+func TestSummarizeIteration(t *testing.T) {
+	results := &TestResults{
+		Steps: []*StepResult{{Step: 0, CacheHit: true}, {Step: 1}},
+		Blocks: []*BlockResult{{
+			Position: "@AFTER_RUN",
+			Assertions: []*AssertionResult{
+				{Status: StatusPassed, Cached: true},
+				{Status: StatusFailed},
+				{Status: StatusSkipped},
+			},
+		}},
+		Duration: 1500 * time.Millisecond,
+	}
+
+	summary := summarizeIteration(results, &AssertionFailedError{Err: errors.New("expected nginx to run")})
+	if !strings.HasSuffix(summary, "] FAIL 2 steps (1 cached), 3 assertions: 1 passed (1 cached), 1 failed, 1 skipped in 1.5s") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+
+	if summary := summarizeIteration(results, errors.New("unable to create container")); !strings.Contains(summary, "] ERROR ") {
+		t.Errorf("Expected an error summary, found %s", summary)
+	}
+}
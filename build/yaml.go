@@ -0,0 +1,505 @@
+package build
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by most configuration files:
+// block mappings and sequences, flow mappings and sequences, plain and quoted
+// scalars, literal and folded block scalars, and comments. Anchors, aliases
+// and tags are rejected, and the documents after the first one are ignored.
+// Mappings are returned as map[string]interface{}, sequences as []interface{}
+// and scalars as strings, or nil for null. Tab indentation, duplicate keys and
+// plain scalars containing ": " are rejected rather than read differently
+// than a YAML library would.
+func parseYAML(content string) (interface{}, error) {
+	p := &yamlParser{lines: strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n")}
+
+	p.skip()
+	if p.i < len(p.lines) && strings.TrimSpace(p.lines[p.i]) == "---" {
+		p.i++
+		p.skip()
+	}
+	if p.done() {
+		return nil, nil
+	}
+
+	value, err := p.block(p.indent())
+	if err != nil {
+		return nil, err
+	}
+
+	p.skip()
+	if !p.done() {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.i+1)
+	}
+
+	return value, nil
+}
+
+type yamlParser struct {
+	lines []string
+	i     int
+}
+
+// skip moves to the next line that is neither blank nor a comment.
+func (p *yamlParser) skip() {
+	for p.i < len(p.lines) {
+		text := strings.TrimSpace(p.lines[p.i])
+		if text != "" && !strings.HasPrefix(text, "#") {
+			return
+		}
+		p.i++
+	}
+}
+
+// done returns whether the end of the first document is reached.
+func (p *yamlParser) done() bool {
+	if p.i >= len(p.lines) {
+		return true
+	}
+
+	text := strings.TrimSpace(p.lines[p.i])
+	return p.indent() == 0 && (text == "---" || text == "...")
+}
+
+func (p *yamlParser) indent() int {
+	return len(p.lines[p.i]) - len(strings.TrimLeft(p.lines[p.i], " "))
+}
+
+// checkIndent returns an error if the current line is indented with tabs,
+// which YAML does not allow.
+func (p *yamlParser) checkIndent() error {
+	if strings.HasPrefix(strings.TrimLeft(p.lines[p.i], " "), "\t") {
+		return fmt.Errorf("line %d: tabs are not allowed for indentation", p.i+1)
+	}
+
+	return nil
+}
+
+// text returns the current line without its indentation and its comment.
+func (p *yamlParser) text() string {
+	return stripYAMLComment(strings.TrimSpace(p.lines[p.i]))
+}
+
+// block parses the mapping or the sequence starting at the current line,
+// whose entries are indented by indent spaces.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(p.text()) {
+		return p.sequence(indent)
+	}
+
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+
+	for p.skip(); !p.done() && p.indent() == indent && isYAMLSequenceItem(p.text()); p.skip() {
+		if err := p.checkIndent(); err != nil {
+			return nil, err
+		}
+
+		line := p.lines[p.i]
+		rest := strings.TrimPrefix(strings.TrimSpace(line), "-")
+		value := strings.TrimLeft(rest, " ")
+
+		if err := checkYAMLNode(value); err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.i+1, err)
+		}
+
+		if stripYAMLComment(value) == "" {
+			p.i++
+			item, err := p.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		_, _, isMapping := splitYAMLKey(stripYAMLComment(value))
+		if isMapping || isYAMLSequenceItem(stripYAMLComment(value)) {
+			// A mapping or a sequence starting on the line of the
+			// item: its entries are aligned with the first one.
+			itemIndent := indent + 1 + len(rest) - len(value)
+			p.lines[p.i] = strings.Repeat(" ", itemIndent) + value
+			item, err := p.block(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		item, err := p.scalar(stripYAMLComment(value), indent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	mapping := map[string]interface{}{}
+
+	for p.skip(); !p.done() && p.indent() == indent; p.skip() {
+		if err := p.checkIndent(); err != nil {
+			return nil, err
+		}
+
+		text := p.text()
+		if isYAMLSequenceItem(text) {
+			break
+		}
+
+		key, value, ok := splitYAMLKey(text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a key followed by a colon", p.i+1)
+		}
+		if err := checkYAMLNode(key); err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.i+1, err)
+		}
+		key, err := unquoteYAML(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", p.i+1, err)
+		}
+		if _, duplicate := mapping[key]; duplicate {
+			return nil, fmt.Errorf("line %d: duplicate key %q", p.i+1, key)
+		}
+
+		if value == "" {
+			p.i++
+			if mapping[key], err = p.nested(indent, true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if mapping[key], err = p.scalar(value, indent); err != nil {
+			return nil, err
+		}
+	}
+
+	return mapping, nil
+}
+
+// nested parses the value of a key or of a sequence item written on the
+// following lines. Sequences may be indented like their key.
+func (p *yamlParser) nested(indent int, sameIndentSequence bool) (interface{}, error) {
+	p.skip()
+	if p.done() {
+		return nil, nil
+	}
+
+	if p.indent() > indent || (sameIndentSequence && p.indent() == indent && isYAMLSequenceItem(p.text())) {
+		return p.block(p.indent())
+	}
+
+	return nil, nil
+}
+
+// scalar parses a value written on the current line, a block scalar starting
+// on the current line, or a flow collection.
+func (p *yamlParser) scalar(value string, indent int) (interface{}, error) {
+	line := p.i + 1
+	p.i++
+
+	if err := checkYAMLNode(value); err != nil {
+		return nil, fmt.Errorf("line %d: %s", line, err)
+	}
+
+	switch {
+	case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+		return p.blockScalar(value, indent), nil
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+		flow := &yamlFlow{text: value}
+		collection, err := flow.value()
+		if err == nil && strings.TrimSpace(flow.text[flow.pos:]) != "" {
+			err = fmt.Errorf("unexpected %q", flow.text[flow.pos:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		return collection, nil
+	}
+
+	if err := checkYAMLPlain(value); err != nil {
+		return nil, fmt.Errorf("line %d: %s", line, err)
+	}
+	scalar, err := unquoteYAML(value)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s", line, err)
+	}
+	if scalar == "~" || scalar == "null" {
+		return nil, nil
+	}
+
+	return scalar, nil
+}
+
+// blockScalar reads the lines of a literal (|) or folded (>) block scalar,
+// more indented than its key.
+func (p *yamlParser) blockScalar(header string, indent int) string {
+	var lines []string
+	contentIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= indent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = lineIndent
+		}
+		if lineIndent < contentIndent {
+			break
+		}
+		lines = append(lines, line[contentIndent:])
+	}
+
+	// Trailing blank lines belong to what follows.
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		p.i--
+	}
+	for p.i < len(p.lines) && p.i > 0 && strings.TrimSpace(p.lines[p.i]) == "" {
+		p.i++
+	}
+
+	text := strings.Join(lines, "\n")
+	if strings.HasPrefix(header, ">") {
+		text = strings.Replace(text, "\n\n", "\x00", -1)
+		text = strings.Replace(text, "\n", " ", -1)
+		text = strings.Replace(text, "\x00", "\n", -1)
+	}
+	if !strings.Contains(header, "-") {
+		text += "\n"
+	}
+
+	return text
+}
+
+// checkYAMLNode returns an error if a node starts with an anchor (&), an
+// alias (*) or a tag (!), which would otherwise be read as part of a plain
+// scalar.
+func checkYAMLNode(text string) error {
+	if text == "" {
+		return nil
+	}
+
+	switch text[0] {
+	case '&':
+		return fmt.Errorf("anchors are not supported")
+	case '*':
+		return fmt.Errorf("aliases are not supported")
+	case '!':
+		return fmt.Errorf("tags are not supported")
+	}
+
+	return nil
+}
+
+// checkYAMLPlain returns an error if a plain scalar contains a colon followed
+// by a space or ends with a colon, as in "a: b: c", which YAML reads as a
+// mapping rather than as a string.
+func checkYAMLPlain(text string) error {
+	if text == "" || text[0] == '"' || text[0] == '\'' {
+		return nil
+	}
+
+	if strings.Contains(text, ": ") || strings.HasSuffix(text, ":") {
+		return fmt.Errorf("unexpected mapping value in %q", text)
+	}
+
+	return nil
+}
+
+// isYAMLSequenceItem returns whether a line is an item of a block sequence.
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a mapping entry into its key and its value, ignoring
+// the colons in quoted keys.
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	start := 0
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		start = end + 2
+	}
+
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// stripYAMLComment removes a comment following a value, outside of quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+
+	return text
+}
+
+// unquoteYAML returns the value of a plain, single-quoted or double-quoted
+// scalar.
+func unquoteYAML(text string) (string, error) {
+	switch {
+	case len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"':
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", text)
+		}
+		return value, nil
+	case len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'':
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+
+	return text, nil
+}
+
+// yamlFlow parses a flow collection such as [a, b] or {a: 1, b: [c]}.
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) value() (interface{}, error) {
+	f.space()
+	if f.pos >= len(f.text) {
+		return nil, fmt.Errorf("unexpected end of flow collection")
+	}
+	if err := checkYAMLNode(f.text[f.pos:]); err != nil {
+		return nil, err
+	}
+
+	switch f.text[f.pos] {
+	case '[':
+		f.pos++
+		items := []interface{}{}
+		for {
+			f.space()
+			if f.consume(']') {
+				return items, nil
+			}
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			f.space()
+			if !f.consume(',') && (f.pos >= len(f.text) || f.text[f.pos] != ']') {
+				return nil, fmt.Errorf("expected , or ] in flow sequence")
+			}
+		}
+	case '{':
+		f.pos++
+		mapping := map[string]interface{}{}
+		for {
+			f.space()
+			if f.consume('}') {
+				return mapping, nil
+			}
+			key, err := f.scalar(":")
+			if err != nil {
+				return nil, err
+			}
+			if !f.consume(':') {
+				return nil, fmt.Errorf("expected : in flow mapping")
+			}
+			value, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, duplicate := mapping[fmt.Sprint(key)]; duplicate {
+				return nil, fmt.Errorf("duplicate key %q", fmt.Sprint(key))
+			}
+			mapping[fmt.Sprint(key)] = value
+			f.space()
+			if !f.consume(',') && (f.pos >= len(f.text) || f.text[f.pos] != '}') {
+				return nil, fmt.Errorf("expected , or } in flow mapping")
+			}
+		}
+	}
+
+	return f.scalar("")
+}
+
+// scalar reads a scalar of a flow collection, ending before a comma, a
+// closing bracket or any of the given delimiters.
+func (f *yamlFlow) scalar(delimiters string) (interface{}, error) {
+	f.space()
+	start := f.pos
+	if f.pos < len(f.text) && (f.text[f.pos] == '"' || f.text[f.pos] == '\'') {
+		quote := f.text[f.pos]
+		for f.pos++; f.pos < len(f.text) && f.text[f.pos] != quote; f.pos++ {
+			if f.text[f.pos] == '\\' && quote == '"' {
+				f.pos++
+			}
+		}
+		f.pos++
+		if f.pos > len(f.text) {
+			return nil, fmt.Errorf("unterminated quoted string")
+		}
+		return unquoteYAML(f.text[start:f.pos])
+	}
+
+	for f.pos < len(f.text) && !strings.ContainsRune(",]}"+delimiters, rune(f.text[f.pos])) {
+		f.pos++
+	}
+
+	value := strings.TrimSpace(f.text[start:f.pos])
+	if err := checkYAMLPlain(value); err != nil {
+		return nil, err
+	}
+	if value == "~" || value == "null" {
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+func (f *yamlFlow) space() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) consume(c byte) bool {
+	if f.pos < len(f.text) && f.text[f.pos] == c {
+		f.pos++
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/l0rd/docker-unit/build"
+)
+
+// Exit codes of docker-unit.
+const (
+	// exitTestFailed is returned when an assertion failed, and for any
+	// error that is not listed below.
+	exitTestFailed = 1
+	// exitUsage is returned when the command line, a Dockerfile or a test
+	// file is invalid.
+	exitUsage = 2
+	// exitBuildFailed is returned when an instruction of a Dockerfile
+	// failed.
+	exitBuildFailed = 3
+	// exitDaemon is returned when the docker daemon could not be reached
+	// or failed to handle a request.
+	exitDaemon = 4
+)
+
+// exitCode returns the exit code matching the type of err.
+func exitCode(err error) int {
+	var (
+		daemonErr    *build.DaemonError
+		configErr    *build.ConfigError
+		buildStepErr *build.BuildStepError
+	)
+
+	switch {
+	case errors.As(err, &daemonErr):
+		return exitDaemon
+	case errors.As(err, &configErr):
+		return exitUsage
+	case errors.As(err, &buildStepErr):
+		return exitBuildFailed
+	default:
+		return exitTestFailed
+	}
+}
+
+// fatal logs err and exits with the exit code matching its type.
+func fatal(err error) {
+	log.Error(err)
+	os.Exit(exitCode(err))
+}
+
+// fatalf logs a message and exits with the given code.
+func fatalf(code int, format string, args ...interface{}) {
+	log.Error(fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+	}{
+		{&build.AssertionFailedError{Err: fmt.Errorf("failed")}, exitTestFailed},
+		{&build.BuildStepError{Err: fmt.Errorf("failed")}, exitBuildFailed},
+		{fmt.Errorf("unable to initialize builder: %w", &build.ConfigError{Err: fmt.Errorf("invalid")}), exitUsage},
+		{fmt.Errorf("1 of 2 images failed: %w", &build.DaemonError{Step: -1, Err: fmt.Errorf("unreachable")}), exitDaemon},
+		{fmt.Errorf("unexpected"), exitTestFailed},
+	}
+
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.expected {
+			t.Errorf("exitCode(%q) == %d, expected %d", c.err, code, c.expected)
+		}
+	}
+}
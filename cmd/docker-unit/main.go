@@ -4,9 +4,11 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/l0rd/docker-unit/build"
@@ -35,13 +37,98 @@ func main() {
 	var (
 		contextDirectory = flag.String("C", ".", "Build context directory")
 		dockerfilePath   = flag.String("f", "", "Path to Dockerfile")
-		repoTag          = flag.String("t", "", "Repository name (and optionally a tag) for the image")
+		repoTag          = flag.String("t", "", "Repository name (and optionally a tag) for the image, or a comma separated list of <path>=<repo[:tag]> with -r")
 	)
 
+	// Multi-image flags.
+	var (
+		recursive    = flag.Bool("r", false, "Build and test every Dockerfile with a test file found under the context directory")
+		concurrency  = flag.Int("j", runtime.NumCPU(), "Maximum number of images built at the same time (with -r)")
+		manifestPath = flag.String("m", "", "JSON file mapping Dockerfile paths to <repo[:tag]> (with -r)")
+	)
+
+	// Report flags.
+	var reports reportList
+	flag.Var(&reports, "report", "Write a test report as <format>=<path>, where format is junit, tap, json, coverage, coverage-json or coverage-dockerfile and - is the standard output (can be repeated)")
+	minCoverage := flag.Float64("min-coverage", 0, "Fail if less than this percentage of the Dockerfile instructions are exercised by a test block")
+
+	verbose := flag.Bool("v", false, "print the output of the assertions that pass")
 	debug := flag.Bool("d", false, "enable debug output")
+	updateSnapshots := flag.Bool("update-snapshots", false, "Rewrite the golden files of the SNAPSHOT_MATCHES assertions instead of comparing them")
+	debugOnFailure := flag.Bool("debug-on-failure", false, "Open a shell in a container from the image an assertion failed against, exit 0 to continue the build")
+	keepOnFailure := flag.Bool("keep-on-failure", false, "Commit the container an assertion failed in to the image cunit-failure/<block>:<run-id>")
+	noTestCache := flag.Bool("no-test-cache", false, "Run every assertion again instead of reusing the ones that passed against the same image and files")
+	watch := flag.Bool("watch", false, "Build and test again every time the Dockerfile, its test file or the files it copies change")
+
+	// Test subcommand flags, to test an existing image without building it.
+	testFlags := flag.NewFlagSet("test", flag.ExitOnError)
+	var (
+		image   = testFlags.String("image", "", "Existing image to test instead of building the Dockerfile")
+		history = testFlags.Bool("history", false, "Run the @BEFORE and @AFTER blocks against the layers of the image history")
+	)
 
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "":
+	case "test":
+		testFlags.Parse(flag.Args()[1:])
+		if *image == "" || testFlags.NArg() > 0 {
+			fatalf(exitUsage, "usage: docker-unit [OPTIONS] test --image <repo[:tag]> [--history]")
+		}
+		if *recursive {
+			fatalf(exitUsage, "test --image cannot be used with -r")
+		}
+		if *minCoverage > 0 {
+			fatalf(exitUsage, "test --image cannot be used with --min-coverage")
+		}
+	case "gc":
+		if flag.NArg() > 1 {
+			fatalf(exitUsage, "usage: docker-unit [OPTIONS] gc")
+		}
+	case "mutate":
+		if flag.NArg() > 1 {
+			fatalf(exitUsage, "usage: docker-unit [OPTIONS] mutate")
+		}
+		if *recursive {
+			fatalf(exitUsage, "mutate cannot be used with -r")
+		}
+		if *updateSnapshots {
+			fatalf(exitUsage, "mutate cannot be used with --update-snapshots")
+		}
+	default:
+		fatalf(exitUsage, "unknown command: %s", flag.Arg(0))
+	}
+
+	if *watch {
+		switch {
+		case flag.Arg(0) != "":
+			fatalf(exitUsage, "%s cannot be used with --watch", flag.Arg(0))
+		case *recursive:
+			fatalf(exitUsage, "--watch cannot be used with -r")
+		case *updateSnapshots:
+			fatalf(exitUsage, "--watch cannot be used with --update-snapshots")
+		case len(reports) > 0:
+			fatalf(exitUsage, "--watch cannot be used with --report")
+		case *debugOnFailure:
+			fatalf(exitUsage, "--watch cannot be used with --debug-on-failure")
+		case *keepOnFailure:
+			fatalf(exitUsage, "--watch cannot be used with --keep-on-failure")
+		}
+	}
+
+	if *debugOnFailure {
+		switch {
+		case *recursive:
+			fatalf(exitUsage, "--debug-on-failure cannot be used with -r")
+		case flag.Arg(0) == "mutate":
+			fatalf(exitUsage, "mutate cannot be used with --debug-on-failure")
+		}
+	}
+	if *keepOnFailure && flag.Arg(0) == "mutate" {
+		fatalf(exitUsage, "mutate cannot be used with --keep-on-failure")
+	}
+
 	if *debug {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -57,17 +144,130 @@ func main() {
     
     getDockerClientConnection(&docker)
 
+	if flag.Arg(0) == "gc" {
+		if err := build.RemoveLeftovers(os.Stdout, build.WithDaemon(docker.daemonURL, docker.tlsConfig)); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Remove the containers of the run when interrupted.
+	build.CleanupOnInterrupt(os.Stderr)
+
+	reporters, closeReporters, err := reports.openReporters(os.Stdout)
+	if err != nil {
+		fatalf(exitUsage, "%s", err)
+	}
+
+	// The build output and the summaries go to the standard error when a
+	// report is written to the standard output, for the report to be parsed.
+	if reports.usesStdout() {
+		os.Stdout = os.Stderr
+	}
+
 	/***************
 	 * Begin Build *
 	 ***************/
 
-	builder, err := build.NewBuilder(docker.daemonURL, docker.tlsConfig, *contextDirectory, *dockerfilePath, *repoTag)
+	if *recursive {
+		targets, err := build.Discover(*contextDirectory)
+		if err != nil {
+			fatalf(exitUsage, "unable to discover Dockerfiles: %s", err)
+		}
+
+		if *manifestPath != "" {
+			repoTags, err := build.LoadManifest(*manifestPath)
+			if err != nil {
+				fatalf(exitUsage, "%s", err)
+			}
+			if err := build.AssignRepoTags(*contextDirectory, targets, repoTags); err != nil {
+				fatalf(exitUsage, "%s", err)
+			}
+		}
+
+		repoTags, err := build.ParseRepoTags(*repoTag)
+		if err != nil {
+			fatalf(exitUsage, "%s", err)
+		}
+		if err := build.AssignRepoTags(*contextDirectory, targets, repoTags); err != nil {
+			fatalf(exitUsage, "%s", err)
+		}
+
+		suite := build.NewSuite(targets, *concurrency,
+			build.WithDaemon(docker.daemonURL, docker.tlsConfig),
+			build.WithReporters(reporters...),
+			build.WithVerbose(*verbose),
+			build.WithUpdateSnapshots(*updateSnapshots),
+			build.WithMinCoverage(*minCoverage),
+			build.WithKeepOnFailure(*keepOnFailure),
+			build.WithTestCache(!*noTestCache),
+		)
+
+		err = suite.Run()
+
+		if reportErr := closeReporters(); reportErr != nil {
+			fatalf(exitUsage, "%s", reportErr)
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	options := []build.Option{
+		build.WithDaemon(docker.daemonURL, docker.tlsConfig),
+		build.WithDockerfile(*dockerfilePath),
+		build.WithRepoTag(*repoTag),
+		build.WithReporters(reporters...),
+		build.WithVerbose(*verbose),
+		build.WithUpdateSnapshots(*updateSnapshots),
+		build.WithMinCoverage(*minCoverage),
+		build.WithDebugOnFailure(*debugOnFailure),
+		build.WithKeepOnFailure(*keepOnFailure),
+		build.WithTestCache(!*noTestCache),
+	}
+	if *image != "" {
+		options = append(options, build.WithImage(*image), build.WithHistory(*history))
+	}
+
+	if *watch {
+		// The watcher runs until the process is interrupted.
+		if err := build.NewWatcher(*contextDirectory, options...).Run(nil); err != nil {
+			fatal(fmt.Errorf("unable to initialize builder: %w", err))
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "mutate" {
+		err = build.NewMutation(*contextDirectory, options...).Run()
+
+		if reportErr := closeReporters(); reportErr != nil {
+			fatalf(exitUsage, "%s", reportErr)
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	builder, err := build.NewBuilder(*contextDirectory, options...)
 	if err != nil {
-		log.Fatalf("unable to initialize builder: %s", err)
+		fatal(fmt.Errorf("unable to initialize builder: %w", err))
 	}
 
-	if err := builder.Run(); err != nil {
-		log.Fatal(err)
+	err = builder.Run()
+
+	if reportErr := closeReporters(); reportErr != nil {
+		fatalf(exitUsage, "%s", reportErr)
+	}
+
+	if err != nil {
+		fatal(err)
 	}
 }
 
@@ -121,12 +321,12 @@ func getDockerClientConnection(docker *dockerClientConnection) {
 		if docker.caCertFile != "" {
 			certBytes, err := ioutil.ReadFile(docker.caCertFile)
 			if err != nil {
-				log.Fatalf("unable to read ca cert file: %s", err)
+				fatalf(exitUsage, "unable to read ca cert file: %s", err)
 			}
 
 			docker.tlsConfig.RootCAs = x509.NewCertPool()
 			if !docker.tlsConfig.RootCAs.AppendCertsFromPEM(certBytes) {
-				log.Fatal("unable to load ca cert file")
+				fatalf(exitUsage, "unable to load ca cert file")
 			}
 		}
 
@@ -152,14 +352,14 @@ func getDockerClientConnection(docker *dockerClientConnection) {
 		certSpecified := docker.clientCertFile != ""
 		keySpecified := docker.clientKeyFile != ""
 		if certSpecified != keySpecified {
-			log.Fatal("must specify both client certificate and key")
+			fatalf(exitUsage, "must specify both client certificate and key")
 		}
 
 		// If both are specified, load them into the tls config.
 		if certSpecified && keySpecified {
 			tlsClientCert, err := tls.LoadX509KeyPair(docker.clientCertFile, docker.clientKeyFile)
 			if err != nil {
-				log.Fatalf("unable to load client cert/key pair: %s", err)
+				fatalf(exitUsage, "unable to load client cert/key pair: %s", err)
 			}
 
 			docker.tlsConfig.Certificates = append(docker.tlsConfig.Certificates, tlsClientCert)
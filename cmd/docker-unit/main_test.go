@@ -41,7 +41,7 @@ func TestDockerUnit(t *testing.T) {
 		defer dockerfile.Close()
 		defer dockertestfile.Close()
 
-		builder, err := build.NewBuilder(docker.daemonURL, docker.tlsConfig, ".", dockerfile.Name(), "")
+		builder, err := build.NewBuilder(".", build.WithDaemon(docker.daemonURL, docker.tlsConfig), build.WithDockerfile(dockerfile.Name()))
 		if err != nil {
 			t.Fatalf("unable to initialize builder: %s", err)
 		}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/l0rd/docker-unit/build"
+)
+
+// reportFormats are the formats accepted by the --report flag.
+var reportFormats = map[string]func(io.Writer) build.Reporter{
+	"junit":               build.NewJUnitReporter,
+	"tap":                 build.NewTAPReporter,
+	"json":                build.NewJSONReporter,
+	"coverage":            build.NewCoverageReporter,
+	"coverage-json":       build.NewCoverageJSONReporter,
+	"coverage-dockerfile": build.NewCoverageDockerfileReporter,
+}
+
+type report struct {
+	format string
+	path   string
+}
+
+// reportList is a flag.Value collecting every --report <format>=<path> flag.
+type reportList []report
+
+func (l *reportList) String() string {
+	reports := make([]string, len(*l))
+	for i, r := range *l {
+		reports[i] = r.format + "=" + r.path
+	}
+
+	return strings.Join(reports, ",")
+}
+
+func (l *reportList) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("expected <format>=<path>, found %q", value)
+	}
+
+	if _, ok := reportFormats[parts[0]]; !ok {
+		return fmt.Errorf("unknown report format %q", parts[0])
+	}
+
+	*l = append(*l, report{format: parts[0], path: parts[1]})
+
+	return nil
+}
+
+// usesStdout returns whether a report is written to the standard output.
+func (l reportList) usesStdout() bool {
+	for _, r := range l {
+		if r.path == "-" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openReporters creates the file of every requested report, "-" meaning the
+// standard output, and returns the reporters writing to them. The returned
+// function closes the reporters and their files. Only one report can be
+// written to the standard output.
+func (l reportList) openReporters(stdout io.Writer) ([]build.Reporter, func() error, error) {
+	var (
+		reporters []build.Reporter
+		files     []*os.File
+		toStdout  []string
+	)
+
+	for _, r := range l {
+		if r.path == "-" {
+			toStdout = append(toStdout, r.format)
+		}
+	}
+	if len(toStdout) > 1 {
+		return nil, nil, fmt.Errorf("only one report can be written to the standard output, found %s", strings.Join(toStdout, ", "))
+	}
+
+	closeAll := func() (err error) {
+		for _, reporter := range reporters {
+			if closeErr := reporter.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("unable to write report: %s", closeErr)
+			}
+		}
+		for _, f := range files {
+			if closeErr := f.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("unable to close report: %s", closeErr)
+			}
+		}
+		return err
+	}
+
+	for _, r := range l {
+		out := stdout
+		if r.path != "-" {
+			f, err := os.Create(r.path)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("unable to create %s report: %s", r.format, err)
+			}
+			files = append(files, f)
+			out = f
+		}
+
+		reporters = append(reporters, reportFormats[r.format](out))
+	}
+
+	return reporters, closeAll, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/l0rd/docker-unit/build"
+)
+
+func TestOpenReporters(t *testing.T) {
+	var reports reportList
+	for _, value := range []string{"json=-", "tap=-"} {
+		if err := reports.Set(value); err != nil {
+			t.Fatalf("unable to set report %s: %s", value, err)
+		}
+	}
+	if !reports.usesStdout() {
+		t.Errorf("Expected the reports to use the standard output")
+	}
+	if _, _, err := reports.openReporters(&bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error writing two reports to the standard output")
+	}
+
+	var stdout bytes.Buffer
+	reporters, closeReporters, err := reports[:1].openReporters(&stdout)
+	if err != nil {
+		t.Fatalf("unable to open reporters: %s", err)
+	}
+	reporters[0].Event(&build.Event{Type: build.EventStepStarted, Command: "FROM alpine"})
+	if err := closeReporters(); err != nil {
+		t.Fatalf("unable to close reporters: %s", err)
+	}
+	if !strings.Contains(stdout.String(), `"command":"FROM alpine"`) {
+		t.Errorf("Expected the JSON report on the standard output, found %q", stdout.String())
+	}
+
+	if (reportList{{format: "junit", path: "report.xml"}}).usesStdout() {
+		t.Errorf("Expected a report file not to use the standard output")
+	}
+}